@@ -0,0 +1,40 @@
+package config
+
+import (
+	"crypto/rand"
+	"log"
+	"os"
+	"time"
+
+	"instagram-lite-backend/internal/auth"
+)
+
+var Signer *auth.TokenSigner
+
+const defaultSessionTTL = 7 * 24 * time.Hour
+
+// InitAuth sets up session token signing from SESSION_SECRET / SESSION_TTL.
+func InitAuth() {
+	secret := []byte(os.Getenv("SESSION_SECRET"))
+	if len(secret) == 0 {
+		// Fine for local dev, but every restart logs everybody out.
+		log.Println("Warning: SESSION_SECRET not set. Using a random secret; sessions will not survive restarts.")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal("Failed to generate session secret:", err)
+		}
+	}
+
+	ttl := defaultSessionTTL
+	if s := os.Getenv("SESSION_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			log.Printf("Warning: invalid SESSION_TTL %q, using %s", s, defaultSessionTTL)
+		} else {
+			ttl = d
+		}
+	}
+
+	Signer = auth.NewTokenSigner(secret, ttl)
+	log.Println("Auth initialized successfully")
+}
@@ -17,7 +17,9 @@ var DB *sql.DB
 
 func InitDB() {
 	var err error
-	DB, err = sql.Open("sqlite3", "instagram.db")
+	// SQLite enforces foreign keys per connection, so enable them in the DSN
+	// (ON DELETE CASCADE on post_tags relies on it).
+	DB, err = sql.Open("sqlite3", "instagram.db?_foreign_keys=on&_busy_timeout=5000")
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -30,16 +32,17 @@ func InitDB() {
 	log.Println("Database connected successfully")
 
 	// Run migrations
-	if err = runMigrations(); err != nil {
+	if err = Migrate(DB, "migrations"); err != nil {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
 	log.Println("Database migrated successfully")
 }
 
-func runMigrations() error {
+// Migrate applies all not yet applied *.sql files in dir to db, in file name order.
+func Migrate(db *sql.DB, dir string) error {
 	// 0) Create migrations tracking table
-	if _, err := DB.Exec(`
+	if _, err := db.Exec(`
 CREATE TABLE IF NOT EXISTS schema_migrations (
   filename TEXT PRIMARY KEY,
   applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -47,8 +50,6 @@ CREATE TABLE IF NOT EXISTS schema_migrations (
 		return fmt.Errorf("create schema_migrations: %w", err)
 	}
 
-	dir := "migrations"
-
 	// 1) Read all *.sql under migrations/
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -71,7 +72,7 @@ CREATE TABLE IF NOT EXISTS schema_migrations (
 
 	// 2) Apply migrations
 	for _, name := range files {
-		applied, err := isMigrationApplied(DB, name)
+		applied, err := isMigrationApplied(db, name)
 		if err != nil {
 			return err
 		}
@@ -85,7 +86,18 @@ CREATE TABLE IF NOT EXISTS schema_migrations (
 			return fmt.Errorf("read migration %s: %w", name, err)
 		}
 
-		tx, err := DB.Begin()
+		// Optional migrations declare the SQLite features they need ("-- requires: fts5").
+		// They are skipped (and retried on the next start) when the driver was built without them.
+		ok, err := migrationSupported(db, string(sqlBytes))
+		if err != nil {
+			return fmt.Errorf("check migration %s: %w", name, err)
+		}
+		if !ok {
+			log.Printf("Warning: skipping migration %s: SQLite built without FTS5 (build with -tags sqlite_fts5)", name)
+			continue
+		}
+
+		tx, err := db.Begin()
 		if err != nil {
 			return fmt.Errorf("begin tx for %s: %w", name, err)
 		}
@@ -112,6 +124,25 @@ CREATE TABLE IF NOT EXISTS schema_migrations (
 	return nil
 }
 
+const requiresFTS5 = "-- requires: fts5"
+
+func migrationSupported(db *sql.DB, migration string) (bool, error) {
+	if !strings.Contains(migration, requiresFTS5) {
+		return true, nil
+	}
+	return HasFTS5(db)
+}
+
+// HasFTS5 reports whether the linked SQLite has the FTS5 extension
+// (github.com/mattn/go-sqlite3 only compiles it in with the sqlite_fts5 build tag).
+func HasFTS5(db *sql.DB) (bool, error) {
+	var used int
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&used); err != nil {
+		return false, err
+	}
+	return used == 1, nil
+}
+
 func isMigrationApplied(db *sql.DB, filename string) (bool, error) {
 	var one int
 	err := db.QueryRow(`SELECT 1 FROM schema_migrations WHERE filename = ? LIMIT 1`, filename).Scan(&one)
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"instagram-lite-backend/internal/imageproc"
+)
+
+// ImageSizes are the rendition edge lengths produced for every upload, ascending.
+var ImageSizes []int
+
+const (
+	minImageSize = 16
+	maxImageSize = 4096
+)
+
+// InitImages reads IMAGE_SIZES, a comma separated list of edge lengths (e.g. "150,512,1080").
+// Falls back to imageproc.DefaultSizes when unset or invalid.
+func InitImages() {
+	ImageSizes = imageproc.DefaultSizes
+	if s := os.Getenv("IMAGE_SIZES"); s != "" {
+		sizes, ok := parseImageSizes(s)
+		if !ok {
+			log.Printf("Warning: invalid IMAGE_SIZES %q, using %v", s, imageproc.DefaultSizes)
+		} else {
+			ImageSizes = sizes
+		}
+	}
+	log.Printf("Image sizes: %v", ImageSizes)
+}
+
+func parseImageSizes(s string) ([]int, bool) {
+	var sizes []int
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < minImageSize || n > maxImageSize {
+			return nil, false
+		}
+		sizes = append(sizes, n)
+	}
+	slices.Sort(sizes)
+	return slices.Compact(sizes), true
+}
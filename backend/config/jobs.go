@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+
+	"instagram-lite-backend/internal/jobs"
+)
+
+// Jobs is the background job queue (image processing of uploads).
+var Jobs *jobs.Queue
+
+// InitJobs creates the job queue from UPLOAD_WORKERS / JOB_MAX_ATTEMPTS. Call after InitDB.
+func InitJobs() {
+	Jobs = jobs.NewQueue(DB, jobs.Config{
+		Workers:     envInt("UPLOAD_WORKERS"),
+		MaxAttempts: envInt("JOB_MAX_ATTEMPTS"),
+	})
+}
+
+// StartJobs runs the workers. Call after every job kind has been registered (SetupRoutes).
+func StartJobs() {
+	if err := Jobs.Start(context.Background()); err != nil {
+		log.Fatal("Failed to start job queue:", err)
+	}
+	log.Println("Job queue started")
+}
+
+// envInt reads a positive integer; 0 (the queue default) when unset or invalid.
+func envInt(name string) int {
+	s := os.Getenv(name)
+	if s == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: invalid %s %q, using the default", name, s)
+		return 0
+	}
+	return n
+}
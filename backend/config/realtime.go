@@ -0,0 +1,75 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Broker relays realtime events between backend instances.
+var Broker realtime.Broker
+
+// Websocket / SSE hardening, see handlers.StreamConfig.
+var (
+	WSAllowedOrigins    []string
+	RealtimeRequireAuth bool
+)
+
+const (
+	BrokerDriverMemory = "memory"
+	BrokerDriverRedis  = "redis"
+)
+
+// InitRealtime selects the realtime broker from REALTIME_BROKER: "memory" (default, a single instance)
+// or "redis" (REDIS_URL, REDIS_CHANNEL), needed as soon as more than one backend instance runs.
+// It also reads WS_ALLOWED_ORIGINS (comma separated) and REALTIME_REQUIRE_AUTH.
+func InitRealtime() {
+	for _, o := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			WSAllowedOrigins = append(WSAllowedOrigins, o)
+		}
+	}
+	if len(WSAllowedOrigins) == 0 {
+		// Fine for local dev, but any website could then open a socket to this API.
+		log.Println("Warning: WS_ALLOWED_ORIGINS not set. Websocket connections are accepted from any origin.")
+	}
+	if s := os.Getenv("REALTIME_REQUIRE_AUTH"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			log.Printf("Warning: invalid REALTIME_REQUIRE_AUTH %q, using false", s)
+		}
+		RealtimeRequireAuth = b
+	}
+	log.Printf("Realtime: allowed origins %v, authentication required: %t", WSAllowedOrigins, RealtimeRequireAuth)
+
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("REALTIME_BROKER")))
+	switch driver {
+	case "", BrokerDriverMemory:
+		Broker = realtime.NewMemoryBroker()
+		log.Println("Realtime broker: memory (single instance)")
+	case BrokerDriverRedis:
+		opts, err := redis.ParseURL(getenvDefault("REDIS_URL", "redis://localhost:6379/0"))
+		if err != nil {
+			log.Fatalf("Invalid REDIS_URL: %v", err)
+		}
+		client := redis.NewClient(opts)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// without the broker, instances would silently stop seeing each other's events
+		if err := client.Ping(ctx).Err(); err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		channel := getenvDefault("REDIS_CHANNEL", "instagram-lite:events")
+		Broker = realtime.NewRedisBroker(client, channel)
+		log.Printf("Realtime broker: redis %s (channel %q)", opts.Addr, channel)
+	default:
+		log.Fatalf("Unknown REALTIME_BROKER %q (want %q or %q)", driver, BrokerDriverMemory, BrokerDriverRedis)
+	}
+}
@@ -4,15 +4,27 @@ import (
 	"context"
 	"log"
 	"os"
+	"strings"
 
 	"instagram-lite-backend/internal/storage"
 )
 
-var Uploader *storage.SpacesUploader
+// Store is the object store used for uploads. nil when no backend could be initialized.
+var Store storage.ObjectStore
 
+const (
+	StorageDriverSpaces = "spaces"
+	StorageDriverLocal  = "local"
+
+	// LocalMediaRoute is where the router serves objects of the local store.
+	LocalMediaRoute = "/media"
+)
+
+// InitStorage selects the storage backend from STORAGE_DRIVER ("spaces" or "local").
+// If STORAGE_DRIVER is empty, Spaces is used when its credentials are set, local disk otherwise.
 func InitStorage() {
 	log.Println(">>> InitStorage called")
-	cfg := storage.SpacesConfig{
+	spacesCfg := storage.SpacesConfig{
 		Endpoint:      os.Getenv("S3_ENDPOINT"),
 		Region:        os.Getenv("S3_REGION"),
 		Bucket:        os.Getenv("S3_BUCKET"),
@@ -20,23 +32,67 @@ func InitStorage() {
 		SecretKey:     os.Getenv("S3_SECRET_KEY"),
 		PublicBaseURL: os.Getenv("S3_PUBLIC_URL"),
 	}
+	spacesConfigured := spacesCfg.Endpoint != "" && spacesCfg.Bucket != "" && spacesCfg.AccessKey != "" && spacesCfg.SecretKey != ""
+
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_DRIVER")))
+	if driver == "" {
+		driver = StorageDriverLocal
+		if spacesConfigured {
+			driver = StorageDriverSpaces
+		}
+	}
 
+	switch driver {
+	case StorageDriverSpaces:
+		initSpacesStorage(spacesCfg, spacesConfigured)
+	case StorageDriverLocal:
+		initLocalStorage()
+	default:
+		log.Printf("Warning: unknown STORAGE_DRIVER %q. Upload functionality will be disabled.", driver)
+	}
+}
+
+func initSpacesStorage(cfg storage.SpacesConfig, configured bool) {
 	log.Printf("S3 config: endpoint=%q region=%q bucket=%q accessKeySet=%v secretKeySet=%v publicBaseURL=%q",
 		cfg.Endpoint, cfg.Region, cfg.Bucket,
 		cfg.AccessKey != "", cfg.SecretKey != "", cfg.PublicBaseURL,
 	)
 
-	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+	if !configured {
 		log.Println("Warning: S3 storage not configured. Upload functionality will be disabled.")
 		return
 	}
 
-	var err error
-	Uploader, err = storage.NewSpacesUploader(context.Background(), cfg)
+	uploader, err := storage.NewSpacesUploader(context.Background(), cfg)
+	if err != nil {
+		log.Printf("Warning: Failed to initialize storage: %v", err)
+		return
+	}
+	Store = uploader
+
+	log.Println("Storage initialized successfully (spaces)")
+}
+
+func initLocalStorage() {
+	cfg := storage.LocalConfig{
+		Dir:           getenvDefault("LOCAL_STORAGE_DIR", "media"),
+		PublicBaseURL: getenvDefault("LOCAL_STORAGE_PUBLIC_URL", "http://localhost:8080"+LocalMediaRoute),
+	}
+	log.Printf("Local storage config: dir=%q publicBaseURL=%q", cfg.Dir, cfg.PublicBaseURL)
+
+	local, err := storage.NewLocalStore(cfg)
 	if err != nil {
 		log.Printf("Warning: Failed to initialize storage: %v", err)
 		return
 	}
+	Store = local
 
-	log.Println("Storage initialized successfully")
+	log.Println("Storage initialized successfully (local)")
+}
+
+func getenvDefault(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
 }
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Orphaned upload collection, see handlers.UploadSweeper.
+var (
+	UploadTTL           time.Duration
+	UploadSweepInterval time.Duration
+	UploadSweepDryRun   bool
+)
+
+const (
+	defaultUploadTTL           = 24 * time.Hour
+	defaultUploadSweepInterval = time.Hour
+)
+
+// InitUploadSweeper reads UPLOAD_TTL, UPLOAD_SWEEP_INTERVAL and UPLOAD_SWEEP_DRY_RUN.
+func InitUploadSweeper() {
+	UploadTTL = envDuration("UPLOAD_TTL", defaultUploadTTL)
+	UploadSweepInterval = envDuration("UPLOAD_SWEEP_INTERVAL", defaultUploadSweepInterval)
+
+	if s := os.Getenv("UPLOAD_SWEEP_DRY_RUN"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			log.Printf("Warning: invalid UPLOAD_SWEEP_DRY_RUN %q, using false", s)
+		}
+		UploadSweepDryRun = b
+	}
+	log.Printf("Orphaned uploads are deleted after %s (sweep every %s, dry run: %t)", UploadTTL, UploadSweepInterval, UploadSweepDryRun)
+}
+
+// envDuration reads a positive duration such as "30m"; def when unset or invalid.
+func envDuration(name string, def time.Duration) time.Duration {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: invalid %s %q, using %s", name, s, def)
+		return def
+	}
+	return d
+}
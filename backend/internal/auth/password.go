@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt only looks at the first 72 bytes, so longer passwords are rejected instead of silently truncated.
+const MaxPasswordBytes = 72
+
+var ErrPasswordTooLong = errors.New("password too long")
+
+func HashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// CheckPassword reports whether password matches the stored bcrypt hash.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// RejectPassword takes as long as CheckPassword against a real hash and always returns false.
+// Login runs it for unknown usernames, so the response time doesn't reveal which usernames exist.
+func RejectPassword(password string) bool {
+	dummyHashOnce.Do(func() {
+		// same cost as HashPassword; the hashed value doesn't matter
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("instagram-lite dummy password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+	return false
+}
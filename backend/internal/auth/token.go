@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims is the signed payload of a session token.
+type Claims struct {
+	UserID    string `json:"uid"` // public user id, not users.id
+	ExpiresAt int64  `json:"exp"` // unix seconds
+}
+
+// TokenSigner issues and verifies HMAC-SHA256 signed session tokens.
+// Token format: base64url(json claims) + "." + base64url(signature)
+type TokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTokenSigner(secret []byte, ttl time.Duration) *TokenSigner {
+	return &TokenSigner{secret: secret, ttl: ttl}
+}
+
+// Issue returns a token for userID and its expiry time.
+func (s *TokenSigner) Issue(userID string) (string, time.Time, error) {
+	exp := time.Now().Add(s.ttl).UTC()
+	payload, err := json.Marshal(Claims{UserID: userID, ExpiresAt: exp.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(s.sign(p)), exp, nil
+}
+
+// Verify checks the signature and expiry and returns the claims.
+func (s *TokenSigner) Verify(token string) (*Claims, error) {
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	// constant time compare
+	if !hmac.Equal(gotSig, s.sign(p)) {
+		return nil, ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c Claims
+	if err := json.Unmarshal(raw, &c); err != nil || c.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= c.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	return &c, nil
+}
+
+func (s *TokenSigner) sign(payload string) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
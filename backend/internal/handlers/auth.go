@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"instagram-lite-backend/internal/auth"
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+	"github.com/oklog/ulid/v2"
+)
+
+type AuthHandler struct {
+	db     *sql.DB
+	signer *auth.TokenSigner
+}
+
+func NewAuthHandler(db *sql.DB, signer *auth.TokenSigner) *AuthHandler {
+	return &AuthHandler{db: db, signer: signer}
+}
+
+// CurrentUser is the authenticated user put on the gin context by Authenticate.
+type CurrentUser struct {
+	DBID     int64 // users.id, never exposed to clients
+	UserID   string
+	Username string
+	Role     string // roleUser or roleAdmin
+}
+
+// Author is the public author info embedded in posts.
+type Author struct {
+	ID       string `json:"id"` // public user id
+	Username string `json:"username"`
+}
+
+type CredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type SessionResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at"`
+	User      Author `json:"user"`
+}
+
+const (
+	currentUserKey   = "currentUser"
+	minPasswordRunes = 8
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+// Register handler: POST /auth/register
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req CredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+
+	username := strings.ToLower(strings.TrimSpace(req.Username))
+	if !usernamePattern.MatchString(username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username must be 3-32 chars of a-z, 0-9 or _"})
+		return
+	}
+	if utf8.RuneCountInString(req.Password) < minPasswordRunes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password too short (min 8 chars)"})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrPasswordTooLong) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "password too long (max 72 bytes)"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "register failed"})
+		return
+	}
+
+	userID := ulid.Make().String()
+	_, err = h.db.ExecContext(
+		c.Request.Context(),
+		`INSERT INTO users (user_id, username, password_hash, created_at) VALUES (?, ?, ?, ?)`,
+		userID, username, hash, time.Now().UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			c.JSON(http.StatusConflict, gin.H{"error": "username already taken"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "register failed"})
+		return
+	}
+
+	h.respondWithSession(c, http.StatusCreated, Author{ID: userID, Username: username})
+}
+
+// Login handler: POST /auth/login
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req CredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	username := strings.ToLower(strings.TrimSpace(req.Username))
+
+	var (
+		user Author
+		hash string
+	)
+	err := h.db.QueryRowContext(
+		c.Request.Context(),
+		`SELECT user_id, username, password_hash FROM users WHERE username = ?`,
+		username,
+	).Scan(&user.ID, &user.Username, &hash)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	// Same response (and the same bcrypt work) for unknown user and wrong password.
+	if err == sql.ErrNoRows {
+		auth.RejectPassword(req.Password)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		return
+	}
+	if !auth.CheckPassword(hash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		return
+	}
+
+	h.respondWithSession(c, http.StatusOK, user)
+}
+
+// Me handler: GET /auth/me
+func (h *AuthHandler) Me(c *gin.Context) {
+	u := currentUser(c)
+	if u == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	c.JSON(http.StatusOK, Author{ID: u.UserID, Username: u.Username})
+}
+
+func (h *AuthHandler) respondWithSession(c *gin.Context, status int, user Author) {
+	token, exp, err := h.signer.Issue(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "issue token failed"})
+		return
+	}
+	c.JSON(status, SessionResponse{
+		Token:     token,
+		ExpiresAt: exp.Format(time.RFC3339),
+		User:      user,
+	})
+}
+
+// Authenticate is a middleware that resolves "Authorization: Bearer <token>" into a CurrentUser.
+// Requests without the header pass through anonymously; a bad or expired token is rejected with 401.
+func (h *AuthHandler) Authenticate(c *gin.Context) {
+	header := strings.TrimSpace(c.GetHeader("Authorization"))
+	if header == "" {
+		c.Next()
+		return
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header"})
+		return
+	}
+
+	user, err := h.userFromToken(c.Request.Context(), strings.TrimSpace(token))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+		return
+	}
+
+	c.Set(currentUserKey, user)
+	c.Next()
+}
+
+// RequireAuth is a middleware that rejects anonymous requests. Must run after Authenticate.
+func RequireAuth(c *gin.Context) {
+	if currentUser(c) == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	c.Next()
+}
+
+// userFromToken verifies the token and loads the user it belongs to.
+// A token for a user that no longer exists is treated as invalid.
+func (h *AuthHandler) userFromToken(ctx context.Context, token string) (*CurrentUser, error) {
+	claims, err := h.signer.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	var u CurrentUser
+	err = h.db.QueryRowContext(
+		ctx,
+		`SELECT id, user_id, username, role FROM users WHERE user_id = ?`,
+		claims.UserID,
+	).Scan(&u.DBID, &u.UserID, &u.Username, &u.Role)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// streamUser is the user of a websocket / SSE request: the one Authenticate resolved from the Authorization
+// header, else the owner of the ?token= query param (browsers can't set headers on those requests).
+// nil for anonymous requests; auth.ErrInvalidToken for a bad token.
+func (h *AuthHandler) streamUser(c *gin.Context) (*CurrentUser, error) {
+	if u := currentUser(c); u != nil {
+		return u, nil
+	}
+	token := strings.TrimSpace(c.Query("token"))
+	if token == "" {
+		return nil, nil
+	}
+	return h.userFromToken(c.Request.Context(), token)
+}
+
+// VerifyStreamToken resolves the token of a websocket auth message, see realtime.TokenVerifier.
+func (h *AuthHandler) VerifyStreamToken(ctx context.Context, token string) (string, error) {
+	u, err := h.userFromToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return "", realtime.ErrInvalidToken
+		}
+		return "", err
+	}
+	return u.UserID, nil
+}
+
+// currentUser returns the authenticated user, or nil for anonymous requests.
+func currentUser(c *gin.Context) *CurrentUser {
+	v, ok := c.Get(currentUserKey)
+	if !ok {
+		return nil
+	}
+	u, _ := v.(*CurrentUser)
+	return u
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+// errForbidden is returned when the current user may not perform a mutation.
+var errForbidden = errors.New("forbidden")
+
+// queryRower is implemented by both *sql.DB and *sql.Tx, so checks can run inside a mutation's transaction.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// authorizePostMutation checks that user may edit or delete the post with the given public id:
+// admins may touch any post, everybody else only their own. Anonymous posts (no author) are admin-only.
+// Returns the internal post id, errPostNotFound or errForbidden.
+func authorizePostMutation(ctx context.Context, q queryRower, user *CurrentUser, postID string) (int64, error) {
+	var (
+		postDBID int64
+		authorID sql.NullInt64
+	)
+	err := q.QueryRowContext(ctx, `SELECT id, author_id FROM posts WHERE post_id = ?`, postID).Scan(&postDBID, &authorID)
+	if err == sql.ErrNoRows {
+		return 0, errPostNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if user == nil {
+		return 0, errForbidden
+	}
+	if user.Role == roleAdmin {
+		return postDBID, nil
+	}
+	if !authorID.Valid || authorID.Int64 != user.DBID {
+		return 0, errForbidden
+	}
+	return postDBID, nil
+}
+
+// errCommentNotFound is returned when no comment with the given public id exists on the post.
+var errCommentNotFound = errors.New("comment not found")
+
+// authorizeCommentDelete checks that user may delete the comment: its author, the author of the post
+// it belongs to, or an admin. Returns the internal comment id, errCommentNotFound or errForbidden.
+func authorizeCommentDelete(ctx context.Context, q queryRower, user *CurrentUser, postID, commentID string) (int64, error) {
+	var (
+		commentDBID   int64
+		commentAuthor sql.NullInt64
+		postAuthor    sql.NullInt64
+	)
+	err := q.QueryRowContext(ctx, `
+SELECT c.id, c.author_id, p.author_id
+FROM comments c
+JOIN posts p ON p.id = c.post_db_id
+WHERE p.post_id = ? AND c.comment_id = ?`,
+		postID, commentID,
+	).Scan(&commentDBID, &commentAuthor, &postAuthor)
+	if err == sql.ErrNoRows {
+		return 0, errCommentNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if user == nil {
+		return 0, errForbidden
+	}
+	if user.Role == roleAdmin {
+		return commentDBID, nil
+	}
+	isOwner := func(author sql.NullInt64) bool { return author.Valid && author.Int64 == user.DBID }
+	if !isOwner(commentAuthor) && !isOwner(postAuthor) {
+		return 0, errForbidden
+	}
+	return commentDBID, nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"instagram-lite-backend/config"
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB opens an in-memory SQLite database with all migrations applied.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	// every new connection would get its own empty in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := config.Migrate(db, filepath.Join("..", "..", "migrations")); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func insertTestUser(t *testing.T, db *sql.DB, userID, role string) *CurrentUser {
+	t.Helper()
+	res, err := db.Exec(
+		`INSERT INTO users (user_id, username, password_hash, role) VALUES (?, ?, 'x', ?)`,
+		userID, userID, role,
+	)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return &CurrentUser{DBID: id, UserID: userID, Username: userID, Role: role}
+}
+
+func insertTestPost(t *testing.T, db *sql.DB, postID string, author *CurrentUser) {
+	t.Helper()
+	var authorID sql.NullInt64
+	if author != nil {
+		authorID = sql.NullInt64{Int64: author.DBID, Valid: true}
+	}
+	if _, err := db.Exec(
+		`INSERT INTO posts (post_id, title, image_url, author_id) VALUES (?, 't', 'http://example.com/a.jpg', ?)`,
+		postID, authorID,
+	); err != nil {
+		t.Fatalf("insert post: %v", err)
+	}
+}
+
+func TestAuthorizePostMutation(t *testing.T) {
+	db := newTestDB(t)
+	alice := insertTestUser(t, db, "alice", roleUser)
+	bob := insertTestUser(t, db, "bob", roleUser)
+	admin := insertTestUser(t, db, "admin", roleAdmin)
+	insertTestPost(t, db, "alice-post", alice)
+	insertTestPost(t, db, "anon-post", nil)
+
+	tests := []struct {
+		name    string
+		user    *CurrentUser
+		postID  string
+		wantErr error
+	}{
+		{"author", alice, "alice-post", nil},
+		{"other user", bob, "alice-post", errForbidden},
+		{"admin", admin, "alice-post", nil},
+		{"anonymous caller", nil, "alice-post", errForbidden},
+		{"anonymous post by user", alice, "anon-post", errForbidden},
+		{"anonymous post by admin", admin, "anon-post", nil},
+		{"unknown post", alice, "missing", errPostNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := authorizePostMutation(context.Background(), db, tt.user, tt.postID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && id <= 0 {
+				t.Fatalf("expected internal post id, got %d", id)
+			}
+		})
+	}
+}
+
+func TestPostMutationsForbiddenForNonAuthor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	alice := insertTestUser(t, db, "alice", roleUser)
+	bob := insertTestUser(t, db, "bob", roleUser)
+	insertTestPost(t, db, "alice-post", alice)
+
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), nil, nil)
+	router := gin.New()
+	asBob := func(c *gin.Context) { c.Set(currentUserKey, bob) }
+	router.PATCH("/posts/:id", asBob, h.UpdatePost)
+	router.DELETE("/posts/:id", asBob, h.DeletePost)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPatch, "/posts/alice-post", strings.NewReader(`{"title":"hijacked"}`)),
+		httptest.NewRequest(http.MethodDelete, "/posts/alice-post", nil),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s: status = %d, want 403", req.Method, w.Code)
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == "" {
+			t.Fatalf("%s: expected ErrorResponse body, got %q", req.Method, w.Body.String())
+		}
+	}
+
+	var title string
+	if err := db.QueryRow(`SELECT title FROM posts WHERE post_id = 'alice-post'`).Scan(&title); err != nil {
+		t.Fatalf("post should still exist: %v", err)
+	}
+	if title != "t" {
+		t.Fatalf("title changed to %q", title)
+	}
+}
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oklog/ulid/v2"
+)
+
+type CommentsHandler struct {
+	db  *sql.DB
+	hub *realtime.Hub
+}
+
+func NewCommentsHandler(db *sql.DB, hub *realtime.Hub) *CommentsHandler {
+	return &CommentsHandler{db: db, hub: hub}
+}
+
+type CreateCommentRequest struct {
+	Body     string `json:"body"`
+	ParentID string `json:"parent_id"` // public id of the comment being replied to; empty for top-level
+}
+
+type CommentItem struct {
+	ID         string  `json:"id"`        // public id
+	ParentID   *string `json:"parent_id"` // null for top-level comments
+	Body       string  `json:"body"`
+	Author     *Author `json:"author"`
+	CreatedAt  string  `json:"created_at"`
+	ReplyCount int     `json:"reply_count"`
+}
+
+type ListCommentsResponse struct {
+	Items      []CommentItem `json:"items"`
+	NextCursor *string       `json:"next_cursor"`
+	HasMore    bool          `json:"has_more"`
+}
+
+const maxCommentRunes = 500
+
+// CreateComment handler: POST /posts/:id/comments
+func (h *CommentsHandler) CreateComment(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+		return
+	}
+	if utf8.RuneCountInString(body) > maxCommentRunes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body too long (max 500 chars)"})
+		return
+	}
+
+	postID := strings.TrimSpace(c.Param("id"))
+	comment, commentCount, err := h.createCommentTx(c.Request.Context(), user, postID, strings.TrimSpace(req.ParentID), body)
+	if err != nil {
+		if errors.Is(err, errPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		if errors.Is(err, errCommentNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent comment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create comment failed"})
+		return
+	}
+
+	// WS broadcast only after DB commit succeeded
+	h.hub.BroadcastCommentCreated(realtime.CommentCreated{
+		PostID:       postID,
+		CommentCount: commentCount,
+		Comment: realtime.CommentItem{
+			ID:        comment.ID,
+			ParentID:  comment.ParentID,
+			Body:      comment.Body,
+			Author:    comment.Author.toRealtime(),
+			CreatedAt: comment.CreatedAt,
+		},
+	})
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// createCommentTx inserts the comment and returns it together with the post's new comment count.
+// parentID must name a comment on the same post (errCommentNotFound otherwise).
+func (h *CommentsHandler) createCommentTx(ctx context.Context, user *CurrentUser, postID, parentID, body string) (*CommentItem, int, error) {
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// rollback if not committed
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	postDBID, err := lookupPostDBID(ctx, tx, postID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var parentDBID sql.NullInt64
+	if parentID != "" {
+		id, err := lookupCommentDBID(ctx, tx, postDBID, parentID)
+		if err != nil {
+			return nil, 0, err
+		}
+		parentDBID = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	commentID := ulid.Make().String()
+	createdAt := time.Now().UTC().Format(time.RFC3339Nano)
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO comments (comment_id, post_db_id, parent_id, author_id, body, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		commentID, postDBID, parentDBID, user.DBID, body, createdAt,
+	); err != nil {
+		return nil, 0, err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM comments WHERE post_db_id = ?`, postDBID).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	committed = true
+
+	comment := &CommentItem{
+		ID:        commentID,
+		Body:      body,
+		Author:    &Author{ID: user.UserID, Username: user.Username},
+		CreatedAt: createdAt,
+	}
+	if parentID != "" {
+		comment.ParentID = &parentID
+	}
+	return comment, count, nil
+}
+
+// ListComments handler: GET /posts/:id/comments
+// Without parent_id it lists top-level comments; with parent_id the replies to that comment.
+// Newest first, paginated with the same (created_at, id) keyset cursor as ListPosts.
+func (h *CommentsHandler) ListComments(c *gin.Context) {
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	cur, err := decodeCursor(strings.TrimSpace(c.Query("cursor")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	postDBID, err := lookupPostDBID(ctx, h.db, strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		if errors.Is(err, errPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list comments failed"})
+		return
+	}
+
+	// NULL parent selects top-level comments ("parent_id IS NULL")
+	var parentDBID sql.NullInt64
+	if parentID := strings.TrimSpace(c.Query("parent_id")); parentID != "" {
+		id, err := lookupCommentDBID(ctx, h.db, postDBID, parentID)
+		if err != nil {
+			if errors.Is(err, errCommentNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "list comments failed"})
+			return
+		}
+		parentDBID = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	q := `
+SELECT
+  c.id,
+  c.comment_id,
+  par.comment_id,
+  c.body,
+  c.created_at,
+  u.user_id,
+  u.username,
+  (SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+FROM comments c
+LEFT JOIN comments par ON par.id = c.parent_id
+LEFT JOIN users u ON u.id = c.author_id
+WHERE
+  c.post_db_id = ?
+  AND c.parent_id IS ?
+  AND (
+    ? = '' OR
+    (c.created_at < ? OR (c.created_at = ? AND c.id < ?))
+  )
+ORDER BY c.created_at DESC, c.id DESC
+LIMIT ?;
+`
+	// Cursor params: if no cursor, we should pass '' to skip.
+	curFlag := ""
+	curCreatedAt := ""
+	curID := int64(0)
+	if cur != nil {
+		curFlag = "1"
+		curCreatedAt = cur.CreatedAt
+		curID = cur.DBID
+	}
+
+	// Fetch limit+1 to know if there is more.
+	rows, err := h.db.QueryContext(
+		ctx,
+		q,
+		postDBID, parentDBID,
+		curFlag, curCreatedAt, curCreatedAt, curID,
+		limit+1,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list comments failed"})
+		return
+	}
+	defer rows.Close()
+
+	type rowItem struct {
+		DBID       int64
+		Item       CommentItem
+		AuthorID   sql.NullString
+		AuthorName sql.NullString
+		ParentID   sql.NullString
+	}
+	raw := make([]rowItem, 0, limit+1)
+	for rows.Next() {
+		var r rowItem
+		if err := rows.Scan(
+			&r.DBID, &r.Item.ID, &r.ParentID, &r.Item.Body, &r.Item.CreatedAt,
+			&r.AuthorID, &r.AuthorName, &r.Item.ReplyCount,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "list comments failed"})
+			return
+		}
+		r.Item.ParentID = nullableString(r.ParentID)
+		r.Item.Author = nullableAuthor(r.AuthorID, r.AuthorName)
+		raw = append(raw, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list comments failed"})
+		return
+	}
+
+	hasMore := false
+	if len(raw) > limit {
+		hasMore = true
+		raw = raw[:limit]
+	}
+
+	output := make([]CommentItem, 0, len(raw))
+	for _, r := range raw {
+		output = append(output, r.Item)
+	}
+
+	var nextCursor *string
+	if hasMore && len(raw) > 0 {
+		last := raw[len(raw)-1]
+		curStr, err := encodeCursor(postsCursor{
+			CreatedAt: last.Item.CreatedAt,
+			DBID:      last.DBID,
+		})
+		if err == nil {
+			nextCursor = &curStr
+		}
+	}
+
+	c.JSON(http.StatusOK, ListCommentsResponse{
+		Items:      output,
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
+	})
+}
+
+// DeleteComment handler: DELETE /posts/:id/comments/:comment_id
+// Replies to the comment are deleted with it (ON DELETE CASCADE).
+func (h *CommentsHandler) DeleteComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	commentDBID, err := authorizeCommentDelete(
+		ctx, h.db, currentUser(c),
+		strings.TrimSpace(c.Param("id")), strings.TrimSpace(c.Param("comment_id")),
+	)
+	if err != nil {
+		if errors.Is(err, errCommentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+			return
+		}
+		if errors.Is(err, errForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to delete this comment"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete comment failed"})
+		return
+	}
+
+	if _, err := h.db.ExecContext(ctx, `DELETE FROM comments WHERE id = ?`, commentDBID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete comment failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func lookupPostDBID(ctx context.Context, q queryRower, postID string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `SELECT id FROM posts WHERE post_id = ?`, postID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errPostNotFound
+	}
+	return id, err
+}
+
+func lookupCommentDBID(ctx context.Context, q queryRower, postDBID int64, commentID string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(
+		ctx,
+		`SELECT id FROM comments WHERE comment_id = ? AND post_db_id = ?`,
+		commentID, postDBID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errCommentNotFound
+	}
+	return id, err
+}
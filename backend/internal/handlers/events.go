@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"instagram-lite-backend/internal/auth"
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeat is how often an idle event stream gets a comment line, so proxies don't time it out.
+const sseHeartbeat = 15 * time.Second
+
+type EventsHandler struct {
+	hub  *realtime.Hub
+	auth *AuthHandler
+	cfg  StreamConfig // only RequireAuth applies: browsers enforce CORS on EventSource
+}
+
+func NewEventsHandler(hub *realtime.Hub, authHandler *AuthHandler, cfg StreamConfig) *EventsHandler {
+	return &EventsHandler{hub: hub, auth: authHandler, cfg: cfg}
+}
+
+// ServeEvents handler: GET /events
+// Server-Sent Events alternative to the websocket, for clients behind proxies that kill websocket upgrades.
+// Each event's data is the same JSON message the websocket sends, and its id "<node>:<seq>" (see realtime.Position),
+// so a reconnecting EventSource resumes with Last-Event-ID (or ?since= and ?node=). SSE has no client messages:
+// tag subscriptions are given up front with repeated ?tag= params, and the token (if any) with the
+// Authorization header or ?token=.
+func (h *EventsHandler) ServeEvents(c *gin.Context) {
+	since, resume, err := resumePosition(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+	if last := strings.TrimSpace(c.GetHeader("Last-Event-ID")); last != "" {
+		if since, err = realtime.ParseEventID(last); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		resume = true
+	}
+
+	user, err := h.auth.streamUser(c)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+		return
+	}
+	if user == nil && h.cfg.RequireAuth {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	client := realtime.NewClient()
+	if user != nil {
+		client.SetUser(user.UserID)
+	}
+	var tags []string
+	for _, t := range c.QueryArray("tag") {
+		if strings.TrimSpace(t) != "" {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) > 0 {
+		if err := client.Subscribe(tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: don't buffer the stream
+	w.WriteHeader(http.StatusOK)
+	// EventSource reconnects after this many milliseconds
+	fmt.Fprint(w, "retry: 3000\n\n")
+	w.Flush()
+
+	if resume {
+		h.hub.Resume(client, since)
+	} else {
+		h.hub.Register(client)
+	}
+	defer h.hub.Unregister(client)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f, ok := <-client.Messages():
+			if !ok {
+				// dropped by the hub (too slow); the client reconnects with Last-Event-ID
+				return
+			}
+			if f.Seq != 0 {
+				fmt.Fprintf(w, "id: %s\n", realtime.Position{Node: h.hub.Node(), Seq: f.Seq}.EventID())
+			}
+			// encoded JSON has no raw newlines, so one data line is enough
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", f.Data); err != nil {
+				return
+			}
+			w.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
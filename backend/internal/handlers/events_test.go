@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sseEvent struct {
+	id   string
+	msg  realtime.Message
+	data json.RawMessage
+}
+
+// openEventStream connects to GET /events of a test server and returns a function reading the next event.
+func openEventStream(t *testing.T, srv *httptest.Server, query, lastEventID string) func() sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events: %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+
+	return func() sseEvent {
+		t.Helper()
+		var ev sseEvent
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatal("event stream closed")
+				}
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					ev.id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "data: "):
+					ev.data = json.RawMessage(strings.TrimPrefix(line, "data: "))
+					if err := json.Unmarshal(ev.data, &ev.msg); err != nil {
+						t.Fatalf("bad data %q: %v", line, err)
+					}
+				case line == "" && ev.data != nil:
+					return ev
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for an event")
+			}
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := realtime.NewHub(realtime.NewMemoryBroker())
+	router := gin.New()
+	router.GET("/events", NewEventsHandler(hub, NewAuthHandler(nil, nil), StreamConfig{}).ServeEvents)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	all := openEventStream(t, srv, "", "")
+	hello := all()
+	if hello.msg.Type != "connected" || hello.id == "" {
+		t.Fatalf("first event = %s (id %q), want connected with an id", hello.msg.Type, hello.id)
+	}
+	cats := openEventStream(t, srv, "?tag=%23cat", "")
+	if ev := cats(); ev.msg.Type != "connected" {
+		t.Fatalf("first event = %s, want connected", ev.msg.Type)
+	}
+
+	hub.BroadcastPostCreated(realtime.PostItem{ID: "dog-post", Tags: []string{"dog"}})
+	hub.BroadcastPostCreated(realtime.PostItem{ID: "cat-post", Tags: []string{"cats"}})
+
+	first := all()
+	second := all()
+	start, err := realtime.ParseEventID(hello.id)
+	if err != nil || start.Node != hub.Node() {
+		t.Fatalf("connected id %q, want one of node %s", hello.id, hub.Node())
+	}
+	want1 := realtime.Position{Node: hub.Node(), Seq: start.Seq + 1}.EventID()
+	want2 := realtime.Position{Node: hub.Node(), Seq: start.Seq + 2}.EventID()
+	if first.id != want1 || second.id != want2 {
+		t.Fatalf("event ids %s, %s, want %s, %s", first.id, second.id, want1, want2)
+	}
+	if ev := cats(); ev.id != second.id {
+		t.Fatalf("subscribed stream got event %s, want only the cat post (%s)", ev.id, second.id)
+	}
+
+	// a reconnecting EventSource sends the last id it saw
+	resumed := openEventStream(t, srv, "", first.id)
+	if ev := resumed(); ev.id != second.id || ev.msg.Type != "post_created" {
+		t.Fatalf("replayed %s %s, want the cat post", ev.id, ev.msg.Type)
+	}
+
+	// ?since= (with or without ?node=) works like on the websocket, and so does a bare sequence id
+	since := strconv.FormatUint(start.Seq+1, 10)
+	for _, tc := range []struct{ query, lastEventID string }{
+		{query: "?since=" + since + "&node=" + hub.Node()},
+		{query: "?since=" + since},
+		{lastEventID: since},
+	} {
+		if ev := openEventStream(t, srv, tc.query, tc.lastEventID)(); ev.id != second.id || ev.msg.Type != "post_created" {
+			t.Fatalf("%+v: replayed %s %s, want the cat post", tc, ev.id, ev.msg.Type)
+		}
+	}
+
+	// evicted, or of another instance
+	for _, last := range []string{
+		realtime.Position{Node: hub.Node(), Seq: 1}.EventID(),
+		realtime.Position{Node: "other", Seq: start.Seq + 1}.EventID(),
+	} {
+		stale := openEventStream(t, srv, "", last)
+		if ev := stale(); ev.msg.Type != "resync_required" || ev.id != second.id {
+			t.Fatalf("Last-Event-ID %s: got %s (id %s), want resync_required with id %s", last, ev.msg.Type, ev.id, second.id)
+		}
+	}
+}
+
+func TestEventStreamRejectsBadParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/events", NewEventsHandler(realtime.NewHub(realtime.NewMemoryBroker()), NewAuthHandler(nil, nil), StreamConfig{}).ServeEvents)
+
+	for _, tc := range []struct {
+		query, lastEventID string
+	}{
+		{lastEventID: "abc"},
+		{query: "?since=-1"},
+		{query: "?tag=%23"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/events"+tc.query, nil)
+		if tc.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", tc.lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%+v: status %d, want 400", tc, rec.Code)
+		}
+	}
+}
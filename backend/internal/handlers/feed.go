@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Feed handler: GET /feed
+// Home timeline: only posts by accounts the caller follows, paginated like ListPosts.
+func (h *PostsHandler) Feed(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	h.listPostsPage(c, postsFilter{
+		where: `
+  p.author_id IN (SELECT f.followee_id FROM follows f WHERE f.follower_id = ?)`,
+		args: []any{user.DBID},
+	})
+}
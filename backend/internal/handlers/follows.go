@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FollowsHandler struct {
+	db *sql.DB
+}
+
+func NewFollowsHandler(db *sql.DB) *FollowsHandler {
+	return &FollowsHandler{db: db}
+}
+
+type FollowResponse struct {
+	ID        string `json:"id"` // public id of the followed user
+	Following bool   `json:"following"`
+}
+
+// Follow handler: POST /users/:id/follow (idempotent)
+func (h *FollowsHandler) Follow(c *gin.Context) {
+	h.setFollow(c, true)
+}
+
+// Unfollow handler: DELETE /users/:id/follow (idempotent)
+func (h *FollowsHandler) Unfollow(c *gin.Context) {
+	h.setFollow(c, false)
+}
+
+func (h *FollowsHandler) setFollow(c *gin.Context, follow bool) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	ctx := c.Request.Context()
+	targetID := strings.TrimSpace(c.Param("id"))
+
+	var targetDBID int64
+	err := h.db.QueryRowContext(ctx, `SELECT id FROM users WHERE user_id = ?`, targetID).Scan(&targetDBID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update follow failed"})
+		return
+	}
+	if targetDBID == user.DBID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot follow yourself"})
+		return
+	}
+
+	if follow {
+		// primary key (follower_id, followee_id) makes a second follow a no-op
+		_, err = h.db.ExecContext(
+			ctx,
+			`INSERT INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?) ON CONFLICT(follower_id, followee_id) DO NOTHING`,
+			user.DBID, targetDBID, time.Now().UTC().Format(time.RFC3339Nano),
+		)
+	} else {
+		_, err = h.db.ExecContext(ctx, `DELETE FROM follows WHERE follower_id = ? AND followee_id = ?`, user.DBID, targetDBID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update follow failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, FollowResponse{ID: targetID, Following: follow})
+}
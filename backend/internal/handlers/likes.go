@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LikeResponse struct {
+	ID        string `json:"id"` // public post id
+	LikeCount int    `json:"like_count"`
+	LikedByMe bool   `json:"liked_by_me"`
+}
+
+// LikePost handler: POST /posts/:id/like (idempotent)
+func (h *PostsHandler) LikePost(c *gin.Context) {
+	h.setLike(c, true)
+}
+
+// UnlikePost handler: DELETE /posts/:id/like (idempotent)
+func (h *PostsHandler) UnlikePost(c *gin.Context) {
+	h.setLike(c, false)
+}
+
+func (h *PostsHandler) setLike(c *gin.Context, liked bool) {
+	postID := strings.TrimSpace(c.Param("id"))
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	count, changed, err := h.setLikeTx(c.Request.Context(), postID, user.DBID, liked)
+	if err != nil {
+		if errors.Is(err, errPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update like failed"})
+		return
+	}
+
+	// Repeated like/unlike requests don't change anything, so don't notify.
+	if changed {
+		h.hub.BroadcastPostLiked(postID, count)
+	}
+
+	c.JSON(http.StatusOK, LikeResponse{ID: postID, LikeCount: count, LikedByMe: liked})
+}
+
+// setLikeTx adds or removes the user's like and returns the new like count
+// and whether the like state actually changed.
+func (h *PostsHandler) setLikeTx(ctx context.Context, postID string, userDBID int64, liked bool) (int, bool, error) {
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return 0, false, err
+	}
+
+	// rollback if not committed
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var postDBID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM posts WHERE post_id = ?`, postID).Scan(&postDBID)
+	if err == sql.ErrNoRows {
+		return 0, false, errPostNotFound
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	var res sql.Result
+	if liked {
+		// primary key (post_db_id, user_db_id) makes a second like a no-op
+		res, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO likes (post_db_id, user_db_id, created_at) VALUES (?, ?, ?) ON CONFLICT(post_db_id, user_db_id) DO NOTHING`,
+			postDBID, userDBID, time.Now().UTC().Format(time.RFC3339Nano),
+		)
+	} else {
+		res, err = tx.ExecContext(ctx, `DELETE FROM likes WHERE post_db_id = ? AND user_db_id = ?`, postDBID, userDBID)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM likes WHERE post_db_id = ?`, postDBID).Scan(&count); err != nil {
+		return 0, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	committed = true
+
+	return count, affected > 0, nil
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// secretQueryParams are query params that carry credentials: browsers can't set headers on
+// EventSource / WebSocket requests, so the session token may come as ?token= (see streamUser).
+var secretQueryParams = map[string]struct{}{"token": {}}
+
+// AccessLogger is gin's request logger with the values of secretQueryParams replaced,
+// so session tokens don't end up in the logs.
+func AccessLogger() gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{Formatter: accessLogFormat})
+}
+
+// accessLogFormat is gin's default log line with a redacted path.
+func accessLogFormat(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactQuery(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactQuery replaces the values of secretQueryParams in a request path with "REDACTED".
+// The rest of the query is left as it was sent.
+func redactQuery(path string) string {
+	p, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if _, secret := secretQueryParams[key]; secret {
+			params[i] = key + "=REDACTED"
+		}
+	}
+	return p + "?" + strings.Join(params, "&")
+}
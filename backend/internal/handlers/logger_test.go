@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactQuery(t *testing.T) {
+	for in, want := range map[string]string{
+		"/api/v1/events":                          "/api/v1/events",
+		"/api/v1/events?tag=cat":                  "/api/v1/events?tag=cat",
+		"/api/v1/events?token=abc.def":            "/api/v1/events?token=REDACTED",
+		"/api/v1/ws?since=12&token=abc&tag=a%20b": "/api/v1/ws?since=12&token=REDACTED&tag=a%20b",
+		"/api/v1/ws?token=a&token=b":              "/api/v1/ws?token=REDACTED&token=REDACTED",
+		"/api/v1/ws?%74oken=abc":                  "/api/v1/ws?token=REDACTED",
+		"/api/v1/ws?tokens=abc&my_token=x&token":  "/api/v1/ws?tokens=abc&my_token=x&token=REDACTED",
+	} {
+		if got := redactQuery(in); got != want {
+			t.Errorf("redactQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAccessLoggerRedactsToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{Formatter: accessLogFormat, Output: &out}))
+	router.GET("/events", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events?tag=cat&token=s3cret", nil))
+	if line := out.String(); strings.Contains(line, "s3cret") || !strings.Contains(line, "/events?tag=cat&token=REDACTED") {
+		t.Fatalf("log line = %q", line)
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/storage"
+)
+
+// negotiatedFormats are offered instead of a requested JPEG when the client's Accept header
+// lists them, best first (AVIF would go in front of WebP). JPEG is the fallback.
+var negotiatedFormats = []imageproc.Format{imageproc.FormatWebP}
+
+// MediaHandler serves stored objects over HTTP.
+// Only mounted for backends without their own public endpoint (the local filesystem store).
+type MediaHandler struct {
+	store storage.ObjectStore
+}
+
+func NewMediaHandler(s storage.ObjectStore) *MediaHandler {
+	return &MediaHandler{store: s}
+}
+
+// Serve expects the object key in the "key" wildcard param, e.g. GET /media/uploads/<ulid>/512.jpg
+// For a .jpg key the response may be a smaller format stored next to it (see negotiatedFormats).
+func (h *MediaHandler) Serve(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	body, info, err := h.negotiate(c, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "read object failed"})
+		return
+	}
+
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+	// keys are immutable (ULID based), same caching policy as Spaces uploads
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	// ServeContent handles Range / If-Modified-Since for us.
+	http.ServeContent(c.Writer, c.Request, key, info.LastModified, bytes.NewReader(body))
+}
+
+// negotiate fetches the best format of key the client accepts, falling back to key itself.
+func (h *MediaHandler) negotiate(c *gin.Context, key string) ([]byte, storage.ObjectInfo, error) {
+	ctx := c.Request.Context()
+	if !strings.HasSuffix(key, imageproc.FormatJPEG.Ext()) {
+		return h.store.Get(ctx, key)
+	}
+
+	// the body depends on Accept, so caches must key on it
+	c.Header("Vary", "Accept")
+	accept := c.GetHeader("Accept")
+	for _, f := range negotiatedFormats {
+		if !acceptsType(accept, f.ContentType()) {
+			continue
+		}
+		body, info, err := h.store.Get(ctx, formatKey(key, f))
+		if err == nil {
+			return body, info, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, storage.ObjectInfo{}, err
+		}
+		// uploaded before this format existed
+	}
+	return h.store.Get(ctx, key)
+}
+
+// acceptsType reports whether the Accept header explicitly lists contentType with a non-zero q.
+// Wildcards don't count: clients that send only */* may not decode newer formats.
+func acceptsType(accept, contentType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), contentType) {
+			continue
+		}
+		for _, p := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(p, "=")
+			if strings.TrimSpace(name) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"instagram-lite-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptsType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"image/webp", true},
+		{"image/avif,image/webp,image/apng,image/*,*/*;q=0.8", true},
+		{"IMAGE/WebP", true},
+		{" image/webp ; q=0.5", true},
+		{"image/webp;q=0", false},
+		{"image/webp; q=0.0", false},
+		{"image/webp;q=0.001", true},
+		{"image/*", false},
+		{"*/*", false},
+		{"image/png,image/jpeg", false},
+		{"image/webpx", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsType(tt.accept, "image/webp"); got != tt.want {
+			t.Errorf("acceptsType(%q) = %t, want %t", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestMediaServeNegotiatesWebP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := storage.NewLocalStore(storage.LocalConfig{Dir: t.TempDir(), PublicBaseURL: "http://localhost/media"})
+	if err != nil {
+		t.Fatalf("local store: %v", err)
+	}
+	ctx := context.Background()
+	for key, body := range map[string]string{
+		"uploads/new/512.jpg":  "jpeg",
+		"uploads/new/512.webp": "webp",
+		"uploads/old/512.jpg":  "old jpeg", // uploaded before WebP encodings were stored
+	} {
+		contentType := "image/jpeg"
+		if key == "uploads/new/512.webp" {
+			contentType = "image/webp"
+		}
+		if err := store.Put(ctx, key, []byte(body), contentType); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	router := gin.New()
+	router.GET("/media/*key", NewMediaHandler(store).Serve)
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		wantCode int
+		wantBody string
+		wantType string
+		wantVary string
+	}{
+		{"webp accepted", "/media/uploads/new/512.jpg", "image/webp,*/*", http.StatusOK, "webp", "image/webp", "Accept"},
+		{"webp refused", "/media/uploads/new/512.jpg", "image/webp;q=0,*/*", http.StatusOK, "jpeg", "image/jpeg", "Accept"},
+		{"wildcards only", "/media/uploads/new/512.jpg", "*/*", http.StatusOK, "jpeg", "image/jpeg", "Accept"},
+		{"no webp stored", "/media/uploads/old/512.jpg", "image/webp", http.StatusOK, "old jpeg", "image/jpeg", "Accept"},
+		{"webp by its own key", "/media/uploads/new/512.webp", "", http.StatusOK, "webp", "image/webp", ""},
+		{"missing", "/media/uploads/gone/512.jpg", "image/webp", http.StatusNotFound, "", "", "Accept"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantCode)
+			continue
+		}
+		if got := w.Header().Get("Vary"); got != tt.wantVary {
+			t.Errorf("%s: Vary = %q, want %q", tt.name, got, tt.wantVary)
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		if got := w.Body.String(); got != tt.wantBody {
+			t.Errorf("%s: body = %q, want %q", tt.name, got, tt.wantBody)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, got, tt.wantType)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"log"
+	"strconv"
+
+	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/storage"
+)
+
+// Reasons CreatePost rejects its image; the messages are returned to the client as is.
+var (
+	errUploadNotFound = errors.New("image_url is not one of our uploads")
+	errUploadNotReady = errors.New("upload is still being processed")
+	errUploadMismatch = errors.New("image_url does not belong to upload_id")
+	errUploadClaimed  = errors.New("upload is already used by another post")
+	errUploadNotOwned = errors.New("upload belongs to someone else")
+)
+
+func isUploadError(err error) bool {
+	return errors.Is(err, errUploadNotFound) || errors.Is(err, errUploadNotReady) ||
+		errors.Is(err, errUploadMismatch) || errors.Is(err, errUploadClaimed) ||
+		errors.Is(err, errUploadNotOwned)
+}
+
+// uploadClaimant is who CreatePost claims an upload for: the signed-in user, who must have uploaded it,
+// or the holder of the upload token of an anonymous upload.
+type uploadClaimant struct {
+	UserDBID  sql.NullInt64
+	TokenHash sql.NullString
+}
+
+func newUploadClaimant(user *CurrentUser, uploadToken string) uploadClaimant {
+	var cl uploadClaimant
+	if user != nil {
+		cl.UserDBID = sql.NullInt64{Int64: user.DBID, Valid: true}
+	}
+	if uploadToken != "" {
+		cl.TokenHash = sql.NullString{String: hashUploadToken(uploadToken), Valid: true}
+	}
+	return cl
+}
+
+// uploadOwnedBy restricts an uploads query to the rows a claimant may claim; takes cl.UserDBID, cl.TokenHash.
+// NULL never compares equal, so an anonymous request without token matches nothing.
+const uploadOwnedBy = `(uploader_id = ? OR claim_token_hash = ?)`
+
+// postImage is what CreatePost learns about its image from the uploads table and the object store.
+type postImage struct {
+	UploadID string            // upload the image belongs to
+	Claimant uploadClaimant    // who resolved it; createPostTx claims the upload for them
+	URL      string            // image_url of the post
+	Images   map[string]string // rendition size -> URL
+	WebP     map[string]string // rendition size -> URL of its WebP encoding, where stored
+	Width    *int              // pixel size of URL; nil if it can't be decoded
+	Height   *int
+	DHash    sql.NullInt64 // perceptual hash of the upload
+}
+
+// resolveUpload finds the recorded, unclaimed upload a new post refers to, by imageURL (any of its renditions),
+// by uploadID (then the post gets the feed-size rendition), or both (which must agree).
+// Identical pictures share their objects (see processUploadJob), so an imageURL can belong to several uploads;
+// an unclaimed one of cl is picked. The claim itself happens in createPostTx, so a concurrent CreatePost
+// can still win with errUploadClaimed there.
+func (h *PostsHandler) resolveUpload(ctx context.Context, cl uploadClaimant, uploadID, imageURL string) (*postImage, error) {
+	if h.store == nil {
+		return nil, errUploadNotFound
+	}
+
+	objectID := ""
+	if imageURL != "" {
+		key, ok := storage.KeyFromURL(h.store, imageURL)
+		if !ok {
+			return nil, errUploadNotFound
+		}
+		if objectID, _, ok = parseRenditionKey(key); !ok {
+			return nil, errUploadNotFound
+		}
+	}
+
+	var (
+		rowUploadID string
+		rowObjectID string
+		feedURL     sql.NullString
+		dhash       sql.NullInt64
+		width       sql.NullInt64
+		height      sql.NullInt64
+		claimed     bool
+	)
+	err := h.db.QueryRowContext(
+		ctx,
+		`SELECT upload_id, object_id, image_url, dhash, width, height, claimed_at IS NOT NULL
+FROM uploads
+WHERE (? = '' OR upload_id = ?) AND (? = '' OR object_id = ?) AND `+uploadOwnedBy+`
+ORDER BY claimed_at IS NOT NULL, id
+LIMIT 1`,
+		uploadID, uploadID, objectID, objectID, cl.UserDBID, cl.TokenHash,
+	).Scan(&rowUploadID, &rowObjectID, &feedURL, &dhash, &width, &height, &claimed)
+	if err == sql.ErrNoRows {
+		return nil, h.noUploadError(ctx, uploadID, objectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if claimed {
+		return nil, errUploadClaimed
+	}
+	if !feedURL.Valid {
+		return nil, errUploadNotReady
+	}
+	if imageURL == "" {
+		imageURL = feedURL.String
+	}
+	img, err := h.resolveImage(ctx, rowUploadID, rowObjectID, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	img.Claimant = cl
+	img.DHash = dhash
+	if imageURL == feedURL.String && width.Valid && height.Valid {
+		// the upload job recorded the pixel size of its feed rendition
+		img.Width, img.Height = nullableInt(width), nullableInt(height)
+	} else if err := h.decodeImageSize(ctx, img); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// noUploadError explains why no upload of the claimant matched uploadID / objectID.
+func (h *PostsHandler) noUploadError(ctx context.Context, uploadID, objectID string) error {
+	var someoneElses bool
+	if err := h.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM uploads WHERE (? = '' OR upload_id = ?) AND (? = '' OR object_id = ?))`,
+		uploadID, uploadID, objectID, objectID,
+	).Scan(&someoneElses); err != nil {
+		return err
+	}
+	if someoneElses {
+		return errUploadNotOwned
+	}
+	if uploadID == "" || objectID == "" {
+		return errUploadNotFound
+	}
+	// tell a typo'd upload_id apart from a URL of another upload
+	exists, err := h.uploadExists(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errUploadMismatch
+	}
+	return errUploadNotFound
+}
+
+func (h *PostsHandler) uploadExists(ctx context.Context, uploadID string) (bool, error) {
+	var exists bool
+	err := h.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM uploads WHERE upload_id = ?)`, uploadID).Scan(&exists)
+	return exists, err
+}
+
+// resolveImage looks up the renditions (stored under objectID) of the upload imageURL points at.
+func (h *PostsHandler) resolveImage(ctx context.Context, uploadID, objectID, imageURL string) (*postImage, error) {
+	img := &postImage{UploadID: uploadID, URL: imageURL, Images: map[string]string{}, WebP: map[string]string{}}
+	key, ok := storage.KeyFromURL(h.store, imageURL)
+	if !ok {
+		return nil, errUploadNotFound
+	}
+	_, size, ok := parseRenditionKey(key)
+	if !ok {
+		return nil, errUploadNotFound
+	}
+	if _, err := h.store.Stat(ctx, key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, errUploadNotFound
+		}
+		return nil, err
+	}
+	img.Images[strconv.Itoa(size)] = imageURL
+	if err := h.resolveWebP(ctx, img, key, size); err != nil {
+		return nil, err
+	}
+
+	for _, s := range h.sizes {
+		if s == size {
+			continue
+		}
+		k := renditionKey(objectID, s)
+		if _, err := h.store.Stat(ctx, k); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				// uploaded with a different size config
+				continue
+			}
+			return nil, err
+		}
+		img.Images[strconv.Itoa(s)] = h.store.PublicURL(k)
+		if err := h.resolveWebP(ctx, img, k, s); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// resolveWebP adds the WebP encoding of the rendition stored as jpegKey to img, unless the upload predates them.
+func (h *PostsHandler) resolveWebP(ctx context.Context, img *postImage, jpegKey string, size int) error {
+	k := formatKey(jpegKey, imageproc.FormatWebP)
+	if _, err := h.store.Stat(ctx, k); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	img.WebP[strconv.Itoa(size)] = h.store.PublicURL(k)
+	return nil
+}
+
+// decodeImageSize reads the pixel size of img.URL from the image header, for renditions other than
+// the feed-size one (and uploads processed before their size was recorded).
+func (h *PostsHandler) decodeImageSize(ctx context.Context, img *postImage) error {
+	key, _ := storage.KeyFromURL(h.store, img.URL)
+	body, _, err := h.store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return errUploadNotFound
+		}
+		return err
+	}
+	// Only the header is decoded
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		log.Printf("decode image config of %s failed: %v", key, err)
+		return nil
+	}
+	img.Width, img.Height = &cfg.Width, &cfg.Height
+	return nil
+}
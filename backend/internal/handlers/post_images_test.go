@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/realtime"
+	"instagram-lite-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreatePostRequiresOwnUnclaimedUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(storage.LocalConfig{Dir: t.TempDir(), PublicBaseURL: "http://localhost/media"})
+	if err != nil {
+		t.Fatalf("local store: %v", err)
+	}
+
+	// not decodable: the pixel size must come from the uploads row, recorded by the upload job
+	key := renditionKey("ready", 512)
+	if err := store.Put(context.Background(), key, []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	readyURL := store.PublicURL(key)
+	webpKey := formatKey(key, imageproc.FormatWebP)
+	if err := store.Put(context.Background(), webpKey, []byte("webp"), "image/webp"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	webpURL := store.PublicURL(webpKey)
+	alice := insertTestUser(t, db, "alice", "user")
+	bob := insertTestUser(t, db, "bob", "user")
+	insertTestUpload(t, db, "ready", time.Minute, false)
+	if _, err := db.Exec(`UPDATE uploads SET image_url = ?, width = 4, height = 5, uploader_id = ? WHERE upload_id = 'ready'`, readyURL, alice.DBID); err != nil {
+		t.Fatalf("mark ready: %v", err)
+	}
+	insertTestUpload(t, db, "pending", time.Minute, false)
+	if _, err := db.Exec(`UPDATE uploads SET uploader_id = ? WHERE upload_id = 'pending'`, alice.DBID); err != nil {
+		t.Fatalf("set uploader: %v", err)
+	}
+
+	// an anonymous upload of the same picture (deduplicated onto the objects of "ready")
+	insertTestUpload(t, db, "anon", time.Minute, false)
+	if _, err := db.Exec(
+		`UPDATE uploads SET image_url = ?, width = 4, height = 5, object_id = 'ready', claim_token_hash = ? WHERE upload_id = 'anon'`,
+		readyURL, hashUploadToken("secret"),
+	); err != nil {
+		t.Fatalf("mark ready: %v", err)
+	}
+
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), store, []int{512})
+	router := gin.New()
+	// X-User stands in for the bearer token
+	router.Use(func(c *gin.Context) {
+		switch c.GetHeader("X-User") {
+		case "alice":
+			c.Set(currentUserKey, alice)
+		case "bob":
+			c.Set(currentUserKey, bob)
+		}
+	})
+	router.POST("/posts", h.CreatePost)
+	create := func(user, body string) (int, string) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/posts", bytes.NewBufferString(body))
+		req.Header.Set("X-User", user)
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Error      string            `json:"error"`
+			ImageURL   string            `json:"image_url"`
+			ImagesWebP map[string]string `json:"images_webp"`
+			Width      *int              `json:"width"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code == http.StatusCreated {
+			if resp.ImageURL != readyURL || resp.ImagesWebP["512"] != webpURL || resp.Width == nil || *resp.Width != 4 {
+				t.Fatalf("created post = %s", w.Body.String())
+			}
+		}
+		return w.Code, resp.Error
+	}
+
+	tests := []struct {
+		name      string
+		user      string
+		body      string
+		wantCode  int
+		wantError string
+	}{
+		{"no image", "alice", `{"title":"t"}`, http.StatusBadRequest, "image_url or upload_id is required"},
+		{"external url", "alice", `{"title":"t","image_url":"https://example.com/cat.jpg"}`, http.StatusBadRequest, errUploadNotFound.Error()},
+		{"unrecorded upload", "alice", `{"title":"t","image_url":"http://localhost/media/uploads/other/512.jpg"}`, http.StatusBadRequest, errUploadNotFound.Error()},
+		{"unknown upload id", "alice", `{"title":"t","upload_id":"nope"}`, http.StatusBadRequest, errUploadNotFound.Error()},
+		{"still processing", "alice", `{"title":"t","upload_id":"pending"}`, http.StatusBadRequest, errUploadNotReady.Error()},
+		{"url of another upload", "alice", `{"title":"t","upload_id":"pending","image_url":"` + readyURL + `"}`, http.StatusBadRequest, errUploadMismatch.Error()},
+		{"someone else's upload", "bob", `{"title":"t","upload_id":"ready"}`, http.StatusForbidden, errUploadNotOwned.Error()},
+		{"anonymous, someone else's upload", "", `{"title":"t","upload_id":"ready"}`, http.StatusForbidden, errUploadNotOwned.Error()},
+		{"anonymous upload without token", "", `{"title":"t","upload_id":"anon"}`, http.StatusForbidden, errUploadNotOwned.Error()},
+		{"anonymous upload, wrong token", "bob", `{"title":"t","upload_id":"anon","upload_token":"guess"}`, http.StatusForbidden, errUploadNotOwned.Error()},
+		{"by upload id", "alice", `{"title":"t","upload_id":"ready"}`, http.StatusCreated, ""},
+		{"already used", "alice", `{"title":"t","image_url":"` + readyURL + `"}`, http.StatusBadRequest, errUploadClaimed.Error()},
+		{"anonymous upload by url and token", "", `{"title":"t","image_url":"` + readyURL + `","upload_token":"secret"}`, http.StatusCreated, ""},
+		{"anonymous upload already used", "", `{"title":"t","upload_id":"anon","upload_token":"secret"}`, http.StatusBadRequest, errUploadClaimed.Error()},
+	}
+	for _, tt := range tests {
+		code, msg := create(tt.user, tt.body)
+		if code != tt.wantCode || msg != tt.wantError {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, code, msg, tt.wantCode, tt.wantError)
+		}
+	}
+
+	// the WebP URLs are stored with the renditions and listed with the posts
+	w := httptest.NewRecorder()
+	router.GET("/posts", h.ListPosts)
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/posts", nil))
+	var list ListPostsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Items) < 2 {
+		t.Fatalf("list posts: %d %s", w.Code, w.Body.String())
+	}
+	// newest first, before the seeded posts
+	for _, p := range list.Items[:2] {
+		if p.ImagesWebP["512"] != webpURL || p.Images["512"] != readyURL {
+			t.Errorf("listed post images %v, webp %v", p.Images, p.ImagesWebP)
+		}
+	}
+}
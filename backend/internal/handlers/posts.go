@@ -1,94 +1,135 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 	"unicode/utf8"
 
 	"instagram-lite-backend/internal/realtime"
+	"instagram-lite-backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/oklog/ulid/v2"
 )
 
 type PostsHandler struct {
-	db  *sql.DB
-	hub *realtime.Hub
+	db    *sql.DB
+	hub   *realtime.Hub
+	store storage.ObjectStore // may be nil when storage is not configured
+	sizes []int               // rendition sizes of uploads, see config.ImageSizes
+	fts   bool                // posts_fts exists (see migrations/009_posts_fts.sql)
 }
 
-func NewPostsHandler(db *sql.DB, hub *realtime.Hub) *PostsHandler {
-	return &PostsHandler{db: db, hub: hub}
+func NewPostsHandler(db *sql.DB, hub *realtime.Hub, store storage.ObjectStore, sizes []int) *PostsHandler {
+	return &PostsHandler{db: db, hub: hub, store: store, sizes: sizes, fts: hasPostsFTS(db)}
 }
 
 type CreatePostRequest struct {
-	ImageURL string   `json:"image_url"`
-	Title    string   `json:"title"`
-	Tags     []string `json:"tags"`
+	ImageURL    string   `json:"image_url"`    // any rendition URL returned by the upload
+	UploadID    string   `json:"upload_id"`    // alternative to image_url: use the upload's feed-size rendition
+	UploadToken string   `json:"upload_token"` // from the upload response; required to post an anonymous upload
+	Title       string   `json:"title"`
+	Tags        []string `json:"tags"`
 }
 
 type PostResponse struct {
-	ID        string    `json:"id"`
-	ImageURL  string   `json:"image_url"`
-	Title     string   `json:"title"`
-	Tags      []string `json:"tags"`
-	CreatedAt string   `json:"created_at"`
+	ID         string            `json:"id"`
+	ImageURL   string            `json:"image_url"`
+	Images     map[string]string `json:"images"`      // rendition size -> URL
+	ImagesWebP map[string]string `json:"images_webp"` // rendition size -> URL of its WebP encoding
+	Width      *int              `json:"width"`       // pixel size of image_url; null for external images
+	Height     *int              `json:"height"`
+	Title      string            `json:"title"`
+	Tags       []string          `json:"tags"`
+	CreatedAt  string            `json:"created_at"`
+	Author     *Author           `json:"author"` // null when posted anonymously
 }
 
+const (
+	maxTitleRunes = 120
+	maxTags       = 10
+)
+
 // Handler for create post
 func (h *PostsHandler) CreatePost(c *gin.Context) {
 	var req CreatePostRequest
-	const MaxTitleRunes = 120
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
 		return
 	}
 
-	req.Title = strings.TrimSpace(req.Title)
 	req.ImageURL = strings.TrimSpace(req.ImageURL)
+	req.UploadID = strings.TrimSpace(req.UploadID)
+	req.UploadToken = strings.TrimSpace(req.UploadToken)
 
-	if req.ImageURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image_url is required"})
+	if req.ImageURL == "" && req.UploadID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_url or upload_id is required"})
 		return
 	}
-	if req.Title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+
+	title, err := validateTitle(req.Title)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	req.Title = title
 
+	tags, err := validateTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-  if utf8.RuneCountInString(req.Title) > MaxTitleRunes {
-    c.JSON(http.StatusBadRequest, gin.H{"error": "title too long (max 120 chars)"})
-    return
-  }
-
-	// Normalize tags: trim, lowercase, bytes limit, dedupe, 
-	tags := normalizeTags(req.Tags)
-	if len(tags) > 10 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "too many tags (max 10)"})
+	// The image must be one of the caller's uploads that no post uses yet; find its renditions and pixel size
+	claimant := newUploadClaimant(currentUser(c), req.UploadToken)
+	img, err := h.resolveUpload(c.Request.Context(), claimant, req.UploadID, req.ImageURL)
+	if err != nil {
+		if errors.Is(err, errUploadNotOwned) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if isUploadError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create post failed"})
 		return
 	}
 
-	post, err := h.createPostTx(c, req.ImageURL, req.Title, tags)
+	// Authentication is optional here; anonymous posts have no author.
+	post, err := h.createPostTx(c, currentUser(c), img, req.Title, tags)
 	if err != nil {
+		if errors.Is(err, errUploadClaimed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "create post failed"})
 		return
 	}
 	// WS broadcast only after DB commit succeeded
 	h.hub.BroadcastPostCreated(realtime.PostItem{
-		ID:        post.ID,
-		Title:     post.Title,
-		ImageURL:  post.ImageURL,
-		Tags:      post.Tags,
-		CreatedAt: post.CreatedAt,
+		ID:         post.ID,
+		Title:      post.Title,
+		ImageURL:   post.ImageURL,
+		Images:     post.Images,
+		ImagesWebP: post.ImagesWebP,
+		Width:      post.Width,
+		Height:     post.Height,
+		Tags:       post.Tags,
+		CreatedAt:  post.CreatedAt,
+		Author:     post.Author.toRealtime(),
 	})
 
 	c.JSON(http.StatusCreated, post)
 }
 
-func (h *PostsHandler) createPostTx(c *gin.Context, imageURL, title string, tags []string) (*PostResponse, error) {
+func (h *PostsHandler) createPostTx(c *gin.Context, author *CurrentUser, img *postImage, title string, tags []string) (*PostResponse, error) {
 	// start transaction
 	tx, err := h.db.BeginTx(c.Request.Context(), &sql.TxOptions{})
 	if err != nil {
@@ -108,11 +149,20 @@ func (h *PostsHandler) createPostTx(c *gin.Context, imageURL, title string, tags
 	// Generate public post id (do NOT expose auto-increment id to clients)
 	publicPostID := ulid.Make().String()
 
+	var (
+		authorDBID sql.NullInt64
+		postAuthor *Author
+	)
+	if author != nil {
+		authorDBID = sql.NullInt64{Int64: author.DBID, Valid: true}
+		postAuthor = &Author{ID: author.UserID, Username: author.Username}
+	}
+
 	// 1) Insert post 
 	res, err := tx.ExecContext(
 		c.Request.Context(),
-		`INSERT INTO posts (post_id, image_url, title, created_at) VALUES (?, ?, ?, ?)`,
-		publicPostID, imageURL, title, createdAt,
+		`INSERT INTO posts (post_id, image_url, title, created_at, author_id, width, height, dhash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		publicPostID, img.URL, title, createdAt, authorDBID, img.Width, img.Height, img.DHash,
 	)
 	if err != nil {
 		return nil, err
@@ -125,35 +175,44 @@ func (h *PostsHandler) createPostTx(c *gin.Context, imageURL, title string, tags
 
 	// 2) Upsert tags + 3) join
 	for _, t := range tags {
-		// tags.name should be unique.
-		if _, err := tx.ExecContext(
-			c.Request.Context(),
-			`INSERT INTO tags (name) VALUES (?) ON CONFLICT(name) DO NOTHING`,
-			t,
-		); err != nil {
+		if err := attachTagTx(c.Request.Context(), tx, postDBID, t); err != nil {
 			return nil, err
 		}
+	}
 
-		var tagID int64
-		if err := tx.QueryRowContext(
-			c.Request.Context(),
-			`SELECT id FROM tags WHERE name = ?`,
-			t,
-		).Scan(&tagID); err != nil {
-			return nil, err
+	// 4) Image renditions
+	for size, url := range img.Images {
+		var webpURL sql.NullString
+		if u, ok := img.WebP[size]; ok {
+			webpURL = sql.NullString{String: u, Valid: true}
 		}
-
-		// post_tags primary key: (post_db_id, tag_id)
-		// "ON CONFLICT DO NOTHING" is used to avoid duplicate insertions (such as duplicates in tags or duplicate requests).
 		if _, err := tx.ExecContext(
 			c.Request.Context(),
-			`INSERT INTO post_tags (post_db_id, tag_id) VALUES (?, ?) ON CONFLICT(post_db_id, tag_id) DO NOTHING`,
-			postDBID, tagID,
+			`INSERT INTO post_images (post_db_id, size, url, webp_url) VALUES (?, ?, ?, ?)`,
+			postDBID, size, url, webpURL,
 		); err != nil {
 			return nil, err
 		}
 	}
 
+	// 5) Claim the upload, so the orphan sweeper leaves its objects alone.
+	// Only its uploader can, and only the first post gets it; a concurrent CreatePost for the same upload rolls back.
+	res, err = tx.ExecContext(
+		c.Request.Context(),
+		`UPDATE uploads SET post_db_id = ?, claimed_at = ? WHERE upload_id = ? AND claimed_at IS NULL AND `+uploadOwnedBy,
+		postDBID, createdAt, img.UploadID, img.Claimant.UserDBID, img.Claimant.TokenHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if claimed == 0 {
+		return nil, errUploadClaimed
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -161,14 +220,71 @@ func (h *PostsHandler) createPostTx(c *gin.Context, imageURL, title string, tags
 
 	return &PostResponse{
 		// it's the public id, not the internal auto-increment id
-		ID:        publicPostID,
-		ImageURL:  imageURL,
-		Title:     title,
-		Tags:      tags,
-		CreatedAt: createdAt,
+		ID:         publicPostID,
+		ImageURL:   img.URL,
+		Images:     img.Images,
+		ImagesWebP: img.WebP,
+		Width:      img.Width,
+		Height:     img.Height,
+		Title:      title,
+		Tags:       tags,
+		CreatedAt:  createdAt,
+		Author:     postAuthor,
 	}, nil
 }
 
+// attachTagTx upserts the tag by name and links it to the post.
+func attachTagTx(ctx context.Context, tx *sql.Tx, postDBID int64, name string) error {
+	// tags.name should be unique.
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO tags (name) VALUES (?) ON CONFLICT(name) DO NOTHING`,
+		name,
+	); err != nil {
+		return err
+	}
+
+	var tagID int64
+	if err := tx.QueryRowContext(
+		ctx,
+		`SELECT id FROM tags WHERE name = ?`,
+		name,
+	).Scan(&tagID); err != nil {
+		return err
+	}
+
+	// post_tags primary key: (post_db_id, tag_id)
+	// "ON CONFLICT DO NOTHING" is used to avoid duplicate insertions (such as duplicates in tags or duplicate requests).
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO post_tags (post_db_id, tag_id) VALUES (?, ?) ON CONFLICT(post_db_id, tag_id) DO NOTHING`,
+		postDBID, tagID,
+	)
+	return err
+}
+
+// validateTitle trims the title and checks it is present and not longer than maxTitleRunes.
+func validateTitle(raw string) (string, error) {
+	title := strings.TrimSpace(raw)
+	if title == "" {
+		return "", errors.New("title is required")
+	}
+	if utf8.RuneCountInString(title) > maxTitleRunes {
+		return "", fmt.Errorf("title too long (max %d chars)", maxTitleRunes)
+	}
+	return title, nil
+}
+
+// validateTags normalizes tags and enforces the maxTags limit.
+func validateTags(raw []string) ([]string, error) {
+	// Normalize tags: trim, lowercase, bytes limit, dedupe
+	tags := normalizeTags(raw)
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("too many tags (max %d)", maxTags)
+	}
+	return tags, nil
+}
+
 func normalizeTags(input []string) []string {
 	// create a map（use struct{} as the value to avoid extra allocations）
 	inputMap := make(map[string]struct{}, len(input))
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeletePost handler: DELETE /posts/:id
+func (h *PostsHandler) DeletePost(c *gin.Context) {
+	postID := strings.TrimSpace(c.Param("id"))
+	if postID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+		return
+	}
+
+	imageURLs, err := h.deletePostTx(c.Request.Context(), currentUser(c), postID)
+	if err != nil {
+		if errors.Is(err, errPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		if errors.Is(err, errForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only the author can delete this post"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete post failed"})
+		return
+	}
+
+	// The post is gone at this point; a failed object cleanup only leaves an orphan behind.
+	for _, u := range imageURLs {
+		h.deleteImageIfUnreferenced(c.Request.Context(), u)
+	}
+
+	// WS broadcast only after DB commit succeeded
+	h.hub.BroadcastPostDeleted(postID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// deletePostTx removes the post (post_tags rows go with it via ON DELETE CASCADE)
+// and prunes tags no other post uses. Returns the image URLs of the deleted post
+// (image_url and its renditions). user must be allowed to mutate the post.
+func (h *PostsHandler) deletePostTx(ctx context.Context, user *CurrentUser, postID string) ([]string, error) {
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// rollback if not committed
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// 1) Resolve public id -> internal id and check ownership
+	postDBID, err := authorizePostMutation(ctx, tx, user, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2) Remember the image URLs and tags before the rows are cascaded away
+	imageURLs, err := queryPostImageURLs(ctx, tx, postDBID)
+	if err != nil {
+		return nil, err
+	}
+	tagIDs, err := queryPostTagIDs(ctx, tx, postDBID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3) Delete the post
+	if _, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE id = ?`, postDBID); err != nil {
+		return nil, err
+	}
+
+	// 4) Prune tags that no longer have any posts
+	if err := pruneOrphanTags(ctx, tx, tagIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return imageURLs, nil
+}
+
+// deleteImageIfUnreferenced removes the backing object of imageURL from storage
+// unless another post still points at it (as image_url or rendition), or an unclaimed upload
+// of the same picture shares it. Errors are only logged.
+func (h *PostsHandler) deleteImageIfUnreferenced(ctx context.Context, imageURL string) {
+	if h.store == nil {
+		return
+	}
+	key, ok := storage.KeyFromURL(h.store, imageURL)
+	if !ok {
+		// not one of our objects (e.g. seeded picsum images)
+		return
+	}
+
+	objectID, _, _ := parseRenditionKey(key)
+	var refs int
+	if err := h.db.QueryRowContext(
+		ctx,
+		`SELECT
+  (SELECT COUNT(*) FROM posts WHERE image_url = ?) +
+  (SELECT COUNT(*) FROM post_images WHERE url = ?) +
+  (SELECT COUNT(*) FROM uploads WHERE object_id = ? AND claimed_at IS NULL)`,
+		imageURL, imageURL, objectID,
+	).Scan(&refs); err != nil {
+		log.Printf("count image references failed: %v", err)
+		return
+	}
+	if refs > 0 {
+		return
+	}
+
+	if strings.HasSuffix(key, imageproc.FormatJPEG.Ext()) {
+		// also the WebP (etc.) stored next to it
+		deleteObjectFormats(ctx, h.store, key)
+		return
+	}
+	if err := h.store.Delete(ctx, key); err != nil {
+		log.Printf("delete object %s failed: %v", key, err)
+	}
+}
+
+// queryPostImageURLs returns the post's image_url and its rendition URLs (deduplicated).
+func queryPostImageURLs(ctx context.Context, tx *sql.Tx, postDBID int64) ([]string, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT image_url FROM posts WHERE id = ? UNION SELECT url FROM post_images WHERE post_db_id = ?`,
+		postDBID, postDBID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
+
+func queryPostTagIDs(ctx context.Context, tx *sql.Tx, postDBID int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT tag_id FROM post_tags WHERE post_db_id = ?`, postDBID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// pruneOrphanTags deletes the given tags if no post_tags row references them anymore.
+func pruneOrphanTags(ctx context.Context, tx *sql.Tx, tagIDs []int64) error {
+	for _, id := range tagIDs {
+		if _, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM tags WHERE id = ? AND NOT EXISTS (SELECT 1 FROM post_tags WHERE tag_id = ?)`,
+			id, id,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
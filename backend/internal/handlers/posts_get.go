@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errPostNotFound is returned by loadPostItem when no post has the given public id.
+var errPostNotFound = errors.New("post not found")
+
+// GetPost handler: GET /posts/:id (id is the public ULID post_id)
+func (h *PostsHandler) GetPost(c *gin.Context) {
+	postID := strings.TrimSpace(c.Param("id"))
+	if postID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+		return
+	}
+
+	item, err := h.loadPostItem(c.Request.Context(), postID, viewerDBID(c))
+	if err != nil {
+		if errors.Is(err, errPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "get post failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// loadPostItem fetches a single post with its tags aggregated, same shape as an item of ListPosts.
+// viewerID is the users.id used for liked_by_me (0 for anonymous).
+func (h *PostsHandler) loadPostItem(ctx context.Context, postID string, viewerID int64) (*PostItem, error) {
+	q := `
+SELECT` + postItemColumns + postItemJoins + `
+WHERE p.post_id = ?
+GROUP BY p.id;
+`
+	var r postRow
+	err := h.db.QueryRowContext(ctx, q, viewerID, postID).Scan(r.scanDest()...)
+	if err == sql.ErrNoRows {
+		return nil, errPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	item := r.item()
+	return &item, nil
+}
+
+// loadPostItemsByDBID loads several posts by internal id in one query, keyed by that id.
+// Posts deleted in the meantime are missing from the map.
+func (h *PostsHandler) loadPostItemsByDBID(ctx context.Context, postDBIDs []int64, viewerID int64) (map[int64]PostItem, error) {
+	items := make(map[int64]PostItem, len(postDBIDs))
+	if len(postDBIDs) == 0 {
+		return items, nil
+	}
+	q := `
+SELECT` + postItemColumns + postItemJoins + `
+WHERE p.id IN (?` + strings.Repeat(", ?", len(postDBIDs)-1) + `)
+GROUP BY p.id;
+`
+	args := []any{viewerID}
+	for _, id := range postDBIDs {
+		args = append(args, id)
+	}
+	rows, err := h.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r postRow
+		if err := rows.Scan(r.scanDest()...); err != nil {
+			return nil, err
+		}
+		items[r.DBID] = r.item()
+	}
+	return items, rows.Err()
+}
@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"strings"
 
+	"instagram-lite-backend/internal/realtime"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,16 +21,114 @@ type ListPostsResponse struct {
 }
 
 type PostItem struct {
-	ID        string   `json:"id"`        // public id 
-	Title     string   `json:"title"`
-	ImageURL  string   `json:"image_url"`
-	Tags      []string `json:"tags"`
-	CreatedAt string   `json:"created_at"` 
+	ID           string   `json:"id"`        // public id 
+	Title        string   `json:"title"`
+	ImageURL     string            `json:"image_url"`
+	Images       map[string]string `json:"images"`      // rendition size -> URL; empty for images not uploaded here
+	ImagesWebP   map[string]string `json:"images_webp"` // rendition size -> URL of its WebP encoding; may be empty
+	Width        *int              `json:"width"`       // pixel size of image_url; null for images not uploaded here
+	Height       *int              `json:"height"`
+	Tags         []string          `json:"tags"`
+	CreatedAt    string            `json:"created_at"` 
+	UpdatedAt    *string           `json:"updated_at"` // null until the post is edited
+	Author       *Author           `json:"author"`     // null for anonymous posts
+	LikeCount    int               `json:"like_count"`
+	LikedByMe    bool              `json:"liked_by_me"` // always false for anonymous viewers
+	CommentCount int               `json:"comment_count"`
+}
+
+// postItemColumns is the SELECT list shared by ListPosts and loadPostItem (scan it with postRow).
+// Its only bind parameter is the viewer's users.id (0 when anonymous) for liked_by_me.
+// Likes and comments are counted (and renditions collected) with scalar subqueries so they don't multiply the GROUP_CONCAT rows.
+const postItemColumns = `
+  p.id,
+  p.post_id,
+  p.title,
+  p.image_url,
+  p.created_at,
+  p.updated_at,
+  p.width,
+  p.height,
+  u.user_id,
+  u.username,
+  GROUP_CONCAT(t.name) AS tags_csv,
+  (SELECT COUNT(*) FROM likes l WHERE l.post_db_id = p.id) AS like_count,
+  EXISTS (SELECT 1 FROM likes l WHERE l.post_db_id = p.id AND l.user_db_id = ?) AS liked_by_me,
+  (SELECT COUNT(*) FROM comments cm WHERE cm.post_db_id = p.id) AS comment_count,
+  (SELECT json_group_object(CAST(pi.size AS TEXT), pi.url) FROM post_images pi WHERE pi.post_db_id = p.id) AS images_json,
+  (SELECT json_group_object(CAST(pi.size AS TEXT), pi.webp_url) FROM post_images pi WHERE pi.post_db_id = p.id AND pi.webp_url IS NOT NULL) AS images_webp_json
+`
+
+// postItemJoins is the FROM clause matching postItemColumns.
+// LEFT JOIN is used to keep posts that have no tags / no author.
+const postItemJoins = `
+FROM posts p
+LEFT JOIN users u ON u.id = p.author_id
+LEFT JOIN post_tags pt ON pt.post_db_id = p.id
+LEFT JOIN tags t ON t.id = pt.tag_id
+`
+
+// postRow is an internal scan target that mirrors postItemColumns.
+type postRow struct {
+	DBID         int64
+	PostID       string
+	Title        string
+	ImageURL     string
+	CreatedAt    string
+	UpdatedAt    sql.NullString
+	Width        sql.NullInt64
+	Height       sql.NullInt64
+	AuthorID     sql.NullString
+	AuthorName   sql.NullString
+	TagsCSV      sql.NullString
+	LikeCount    int
+	LikedByMe    bool
+	CommentCount int
+	ImagesJSON   sql.NullString
+	WebPJSON     sql.NullString
+}
+
+func (r *postRow) scanDest() []any {
+	return []any{
+		&r.DBID, &r.PostID, &r.Title, &r.ImageURL, &r.CreatedAt, &r.UpdatedAt, &r.Width, &r.Height,
+		&r.AuthorID, &r.AuthorName, &r.TagsCSV, &r.LikeCount, &r.LikedByMe, &r.CommentCount,
+		&r.ImagesJSON, &r.WebPJSON,
+	}
+}
+
+// raw DBID doesn't need to output to client.
+func (r *postRow) item() PostItem {
+	return PostItem{
+		ID:           r.PostID,
+		Title:        r.Title,
+		ImageURL:     r.ImageURL,
+		Images:       parseImagesJSON(r.ImagesJSON),
+		ImagesWebP:   parseImagesJSON(r.WebPJSON),
+		Width:        nullableInt(r.Width),
+		Height:       nullableInt(r.Height),
+		Tags:         splitCSVTags(r.TagsCSV),
+		CreatedAt:    r.CreatedAt,
+		UpdatedAt:    nullableString(r.UpdatedAt),
+		Author:       nullableAuthor(r.AuthorID, r.AuthorName),
+		LikeCount:    r.LikeCount,
+		LikedByMe:    r.LikedByMe,
+		CommentCount: r.CommentCount,
+	}
+}
+
+// viewerDBID returns users.id of the current user, or 0 for anonymous requests.
+func viewerDBID(c *gin.Context) int64 {
+	if u := currentUser(c); u != nil {
+		return u.DBID
+	}
+	return 0
 }
 
 type postsCursor struct {
 	CreatedAt string `json:"created_at"`
 	DBID      int64  `json:"db_id"`
+	// Rank is set for pages of ranked search results (ordered by rank, then id).
+	Rank *float64 `json:"rank,omitempty"`
 }
 
 func encodeCursor(c postsCursor) (string, error) {
@@ -41,6 +141,15 @@ func encodeCursor(c postsCursor) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
+// nextPostsCursor encodes c, returning nil if encoding fails (the client then simply gets no next page).
+func nextPostsCursor(c postsCursor) *string {
+	s, err := encodeCursor(c)
+	if err != nil {
+		return nil
+	}
+	return &s
+}
+
 func decodeCursor(s string) (*postsCursor, error) {
 	if strings.TrimSpace(s) == "" {
 		return nil, nil
@@ -83,6 +192,37 @@ func splitCSVTags(csv sql.NullString) []string {
 	return output
 }
 
+// parseImagesJSON decodes the json_group_object of post_images; never returns nil.
+func parseImagesJSON(ns sql.NullString) map[string]string {
+	images := map[string]string{}
+	if ns.Valid {
+		_ = json.Unmarshal([]byte(ns.String), &images)
+	}
+	return images
+}
+
+func nullableString(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
+
+func nullableInt(ni sql.NullInt64) *int {
+	if !ni.Valid {
+		return nil
+	}
+	n := int(ni.Int64)
+	return &n
+}
+
+func nullableAuthor(id, username sql.NullString) *Author {
+	if !id.Valid {
+		return nil
+	}
+	return &Author{ID: id.String, Username: username.String}
+}
+
 // Valite limit
 func parseLimit(c *gin.Context) (int, error) {
 	const (
@@ -107,8 +247,52 @@ func parseLimit(c *gin.Context) (int, error) {
 	return n, nil
 }
 
+// postsFilter is an extra SQL condition (ANDed into the WHERE clause, posts aliased as p) with its bind args.
+type postsFilter struct {
+	where string
+	args  []any
+	// match, when set, is an FTS5 query: only matching posts are returned,
+	// ordered by relevance instead of recency.
+	match string
+}
+
 // ListPosts handler
 func (h *PostsHandler) ListPosts(c *gin.Context) {
+	// trim, turn it to lower case and drop a leading '#' (same rules as websocket tag subscriptions)
+	tag := realtime.NormalizeTagQuery(c.Query("tag"))
+	search := strings.TrimSpace(c.Query("q"))
+
+	/**
+	-- Optional fuzzy tag filter:
+  -- If tag query is empty, do not filter by tags.
+  -- Otherwise keep the post if it has at least one tag whose name contains the query.
+	**/
+	filter := postsFilter{
+		where: `
+  (
+    ? = '' OR
+    EXISTS (
+      SELECT 1
+      FROM post_tags pt2
+      JOIN tags t2 ON t2.id = pt2.tag_id
+      WHERE pt2.post_db_id = p.id
+        AND t2.name LIKE '%' || ? || '%'
+    )
+  )`,
+		args: []any{tag, tag},
+	}
+
+	// Optional full-text search over title and tags (see search.go).
+	if search != "" {
+		h.applySearch(&filter, search)
+	}
+
+	h.listPostsPage(c, filter)
+}
+
+// listPostsPage writes one page of posts matching filter, newest first,
+// with keyset pagination on (created_at, id). Shared by ListPosts and Feed.
+func (h *PostsHandler) listPostsPage(c *gin.Context, filter postsFilter) {
 	// Validate Limit
 	limit, err := parseLimit(c)
 	if err != nil {
@@ -116,8 +300,6 @@ func (h *PostsHandler) ListPosts(c *gin.Context) {
 		return
 	}
 
-	// trim and turn it to lower case
-	tag := strings.ToLower(strings.TrimSpace(c.Query("tag")))
 	// trim cursor 
 	cursorStr := strings.TrimSpace(c.Query("cursor"))
 
@@ -127,44 +309,31 @@ func (h *PostsHandler) ListPosts(c *gin.Context) {
 		return
 	}
 
+	// A cursor only makes sense for the ordering it was issued for.
+	ranked := filter.match != ""
+	if cur != nil && (cur.Rank != nil) != ranked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+
+	if ranked {
+		h.listRankedPostsPage(c, filter, cur, limit)
+		return
+	}
+
 	// Fetch limit+1 to know if there is more.
 	limitPlusOne := limit + 1
 
-	// List posts with keyset pagination (created_at, id) and fuzzy tag filter.
+	// List posts with keyset pagination (created_at, id) and the caller's filter.
 	//  Tags are aggregated via GROUP_CONCAT.
-	// LEFT JOIN is used to keep posts that have no tags.
-	/**
-	-- Optional fuzzy tag filter:
-  -- If tag query is empty, do not filter by tags.
-  -- Otherwise keep the post if it has at least one tag whose name contains the query.
-	**/
 	/**
 	 -- Optional pagination (created_at, id):
    -- If cursor is empty, return the first page.
    -- Otherwise return posts  older than the cursor.
 	**/
 	q := `
-SELECT
-  p.id,
-  p.post_id,
-  p.title,
-  p.image_url,
-  p.created_at,
-  GROUP_CONCAT(t.name) AS tags_csv 
-FROM posts p
-LEFT JOIN post_tags pt ON pt.post_db_id = p.id
-LEFT JOIN tags t ON t.id = pt.tag_id
-WHERE
-  (
-    ? = '' OR
-    EXISTS (
-      SELECT 1
-      FROM post_tags pt2
-      JOIN tags t2 ON t2.id = pt2.tag_id
-      WHERE pt2.post_db_id = p.id
-        AND t2.name LIKE '%' || ? || '%'
-    )
-  )
+SELECT` + postItemColumns + postItemJoins + `
+WHERE` + filter.where + `
   AND (
     ? = '' OR
     (p.created_at < ? OR (p.created_at = ? AND p.id < ?))
@@ -185,13 +354,10 @@ LIMIT ?;
 	}
 
 	ctx := c.Request.Context()
-	rows, err := h.db.QueryContext(
-		ctx,
-		q,
-		tag, tag,
-		curFlag, curCreatedAt, curCreatedAt, curID,
-		limitPlusOne,
-	)
+	args := []any{viewerDBID(c)}
+	args = append(args, filter.args...)
+	args = append(args, curFlag, curCreatedAt, curCreatedAt, curID, limitPlusOne)
+	rows, err := h.db.QueryContext(ctx, q, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "list posts failed"})
 		return
@@ -199,25 +365,16 @@ LIMIT ?;
 	// Always close rows to release the underlying DB connection.
 	defer rows.Close()
 
-	// rowItem is an internal scan target that mirrors the SELECT list.
-	type rowItem struct {
-		DBID      int64
-		PostID    string
-		Title     string
-		ImageURL  string
-		CreatedAt string
-		TagsCSV   sql.NullString
-	}
 	// the final output items
 	output := make([]PostItem, 0, limitPlusOne)
 	// it stores the scanned DB rows(we need to process them: split tags, compute next cursor, has_more)
-	raw := make([]rowItem, 0, limitPlusOne)
+	raw := make([]postRow, 0, limitPlusOne)
 
 	// iterate rows and fill the `raw` 
 	for rows.Next() {
-		var r rowItem
-		// Scan the current row into rowItem
-		if err := rows.Scan(&r.DBID, &r.PostID, &r.Title, &r.ImageURL, &r.CreatedAt, &r.TagsCSV); err != nil {
+		var r postRow
+		// Scan the current row into postRow
+		if err := rows.Scan(r.scanDest()...); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "list posts failed"})
 			return
 		}
@@ -236,28 +393,18 @@ LIMIT ?;
 		raw = raw[:limit]
 	}
 
-	// raw DBID doesn't need to output to client.
 	for _, r := range raw {
-		output = append(output, PostItem{
-			ID:        r.PostID,
-			Title:     r.Title,
-			ImageURL:  r.ImageURL,
-			Tags:      splitCSVTags(r.TagsCSV),
-			CreatedAt: r.CreatedAt,
-		})
+		output = append(output, r.item())
 	}
 
 	// Calcuate next cursor
 	var nextCursor *string
 	if hasMore && len(raw) > 0 {
 		last := raw[len(raw)-1]
-		curStr, err := encodeCursor(postsCursor{
+		nextCursor = nextPostsCursor(postsCursor{
 			CreatedAt: last.CreatedAt,
 			DBID:      last.DBID,
 		})
-		if err == nil {
-			nextCursor = &curStr
-		}
 	}
 
 	c.JSON(http.StatusOK, ListPostsResponse{
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdatePostRequest is a partial update: omitted fields are left unchanged.
+// "tags": [] clears all tags.
+type UpdatePostRequest struct {
+	Title *string   `json:"title"`
+	Tags  *[]string `json:"tags"`
+}
+
+// UpdatePost handler: PATCH /posts/:id
+func (h *PostsHandler) UpdatePost(c *gin.Context) {
+	postID := strings.TrimSpace(c.Param("id"))
+	if postID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+		return
+	}
+
+	var req UpdatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if req.Title == nil && req.Tags == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	// Same validation rules as CreatePost
+	var title *string
+	if req.Title != nil {
+		t, err := validateTitle(*req.Title)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		title = &t
+	}
+	var tags []string
+	if req.Tags != nil {
+		t, err := validateTags(*req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tags = t
+	}
+
+	ctx := c.Request.Context()
+	if err := h.updatePostTx(ctx, currentUser(c), postID, title, tags, req.Tags != nil); err != nil {
+		if errors.Is(err, errPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		if errors.Is(err, errForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only the author can edit this post"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update post failed"})
+		return
+	}
+
+	post, err := h.loadPostItem(ctx, postID, viewerDBID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update post failed"})
+		return
+	}
+
+	// WS broadcast only after DB commit succeeded
+	h.hub.BroadcastPostUpdated(post.toRealtime())
+
+	c.JSON(http.StatusOK, post)
+}
+
+// updatePostTx applies the title change and the tag diff in one transaction.
+// Tags are only touched when replaceTags is true. user must be allowed to mutate the post.
+func (h *PostsHandler) updatePostTx(ctx context.Context, user *CurrentUser, postID string, title *string, tags []string, replaceTags bool) error {
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	// rollback if not committed
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	postDBID, err := authorizePostMutation(ctx, tx, user, postID)
+	if err != nil {
+		return err
+	}
+
+	updatedAt := time.Now().UTC().Format(time.RFC3339Nano)
+
+	// 1) Title + updated_at
+	if title != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET title = ?, updated_at = ? WHERE id = ?`, *title, updatedAt, postDBID)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET updated_at = ? WHERE id = ?`, updatedAt, postDBID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2) Tag diff
+	if replaceTags {
+		if err := replacePostTagsTx(ctx, tx, postDBID, tags); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// replacePostTagsTx makes the post's tag set equal to tags: unlinks removed tags
+// (pruning those left without posts) and attaches new ones.
+func replacePostTagsTx(ctx context.Context, tx *sql.Tx, postDBID int64, tags []string) error {
+	rows, err := tx.QueryContext(ctx, `
+SELECT t.id, t.name
+FROM post_tags pt
+JOIN tags t ON t.id = pt.tag_id
+WHERE pt.post_db_id = ?`, postDBID)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]int64)
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		current[name] = id
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	wanted := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		wanted[t] = struct{}{}
+	}
+
+	// remove
+	var removed []int64
+	for name, id := range current {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM post_tags WHERE post_db_id = ? AND tag_id = ?`, postDBID, id); err != nil {
+			return err
+		}
+		removed = append(removed, id)
+	}
+	if err := pruneOrphanTags(ctx, tx, removed); err != nil {
+		return err
+	}
+
+	// add
+	for _, t := range tags {
+		if _, ok := current[t]; ok {
+			continue
+		}
+		if err := attachTagTx(ctx, tx, postDBID, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p PostItem) toRealtime() realtime.PostItem {
+	return realtime.PostItem{
+		ID:           p.ID,
+		Title:        p.Title,
+		ImageURL:     p.ImageURL,
+		Images:       p.Images,
+		ImagesWebP:   p.ImagesWebP,
+		Width:        p.Width,
+		Height:       p.Height,
+		Tags:         p.Tags,
+		CreatedAt:    p.CreatedAt,
+		UpdatedAt:    p.UpdatedAt,
+		Author:       p.Author.toRealtime(),
+		LikeCount:    p.LikeCount,
+		CommentCount: p.CommentCount,
+	}
+}
+
+func (a *Author) toRealtime() *realtime.Author {
+	if a == nil {
+		return nil
+	}
+	return &realtime.Author{ID: a.ID, Username: a.Username}
+}
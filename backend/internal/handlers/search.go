@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSearchTerms caps how many words of ?q= are used, to keep MATCH queries cheap.
+const maxSearchTerms = 8
+
+// hasPostsFTS reports whether the posts_fts index was created by the migrations and can be used:
+// a binary built without FTS5 (no sqlite_fts5 tag) may open a database an FTS5 build migrated.
+func hasPostsFTS(db *sql.DB) bool {
+	var one int
+	err := db.QueryRow(`SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'posts_fts'`).Scan(&one)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("check posts_fts failed: %v", err)
+		}
+		return false
+	}
+	var used int
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&used); err != nil {
+		log.Printf("check fts5 failed: %v", err)
+		return false
+	}
+	if used != 1 {
+		log.Printf("Warning: posts_fts exists but SQLite was built without FTS5 (build with -tags sqlite_fts5); search falls back to LIKE")
+	}
+	return used == 1
+}
+
+// searchTerms splits q into lower-cased words of letters and digits ("#Sunset beach!" -> sunset, beach).
+func searchTerms(q string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// ftsMatchQuery builds an FTS5 query requiring every term, each as a prefix
+// ("sun beach" -> "sun"* "beach"*). Quoting keeps user input from being parsed as FTS syntax.
+func ftsMatchQuery(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		parts = append(parts, `"`+t+`"*`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// applySearch narrows filter to posts whose title or tags match q.
+// With posts_fts the results are ranked by relevance; without it every term
+// must appear (as a substring) in the title or a tag and results stay newest first.
+func (h *PostsHandler) applySearch(filter *postsFilter, q string) {
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return
+	}
+
+	if h.fts {
+		filter.match = ftsMatchQuery(terms)
+		return
+	}
+
+	for _, t := range terms {
+		filter.where += `
+  AND (
+    p.title LIKE '%' || ? || '%' OR
+    EXISTS (
+      SELECT 1
+      FROM post_tags pt3
+      JOIN tags t3 ON t3.id = pt3.tag_id
+      WHERE pt3.post_db_id = p.id
+        AND t3.name LIKE '%' || ? || '%'
+    )
+  )`
+		filter.args = append(filter.args, t, t)
+	}
+}
+
+// listRankedPostsPage is listPostsPage for full-text matches: best match first
+// (bm25, title hits weigh more than tag hits), ties broken by newest id.
+// The keyset cursor is (rank, id). It is only stable while the index doesn't change: bm25 uses
+// index-wide statistics, so any post write between two pages moves every rank and the next page
+// may skip or repeat results.
+func (h *PostsHandler) listRankedPostsPage(c *gin.Context, filter postsFilter, cur *postsCursor, limit int) {
+	// The matches are MATERIALIZED: bm25() only works in a plain FTS5 query,
+	// not once SQLite flattens it into the grouped outer SELECT.
+	q := `
+WITH s AS MATERIALIZED (
+  SELECT rowid AS post_db_id, bm25(posts_fts, 10.0, 5.0) AS score
+  FROM posts_fts
+  WHERE posts_fts MATCH ?
+)
+SELECT` + postItemColumns + `, s.score` + postItemJoins + `
+JOIN s ON s.post_db_id = p.id
+WHERE` + filter.where + `
+  AND (
+    ? = '' OR
+    (s.score > ? OR (s.score = ? AND p.id < ?))
+  )
+GROUP BY p.id
+ORDER BY s.score ASC, p.id DESC
+LIMIT ?;
+`
+
+	// Cursor params: if no cursor, we should pass '' to skip.
+	curFlag := ""
+	curRank := 0.0
+	curID := int64(0)
+	if cur != nil {
+		curFlag = "1"
+		curRank = *cur.Rank
+		curID = cur.DBID
+	}
+
+	ctx := c.Request.Context()
+	args := []any{filter.match, viewerDBID(c)}
+	args = append(args, filter.args...)
+	args = append(args, curFlag, curRank, curRank, curID, limit+1)
+	rows, err := h.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list posts failed"})
+		return
+	}
+	defer rows.Close()
+
+	type rankedRow struct {
+		postRow
+		Rank float64
+	}
+	raw := make([]rankedRow, 0, limit+1)
+	for rows.Next() {
+		var r rankedRow
+		if err := rows.Scan(append(r.scanDest(), &r.Rank)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "list posts failed"})
+			return
+		}
+		raw = append(raw, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list posts failed"})
+		return
+	}
+
+	hasMore := false
+	if len(raw) > limit {
+		hasMore = true
+		raw = raw[:limit]
+	}
+
+	output := make([]PostItem, 0, len(raw))
+	for _, r := range raw {
+		output = append(output, r.item())
+	}
+
+	var nextCursor *string
+	if hasMore && len(raw) > 0 {
+		last := raw[len(raw)-1]
+		rank := last.Rank
+		nextCursor = nextPostsCursor(postsCursor{
+			CreatedAt: last.CreatedAt,
+			DBID:      last.DBID,
+			Rank:      &rank,
+		})
+	}
+
+	c.JSON(http.StatusOK, ListPostsResponse{
+		Items:      output,
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
+	})
+}
@@ -0,0 +1,183 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newSearchRouter(t *testing.T, h *PostsHandler, user *CurrentUser) *gin.Engine {
+	t.Helper()
+	if !h.fts {
+		t.Fatal("posts_fts is not available")
+	}
+	router := gin.New()
+	asUser := func(c *gin.Context) { c.Set(currentUserKey, user) }
+	router.GET("/posts", h.ListPosts)
+	router.PATCH("/posts/:id", asUser, h.UpdatePost)
+	router.DELETE("/posts/:id", asUser, h.DeletePost)
+	return router
+}
+
+func TestSearchRanking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	insertSearchPost(t, db, "title-hit", "Wombat crossing", "2024-01-01T00:00:00Z", nil)
+	insertSearchPost(t, db, "tag-hit", "Evening walk", "2024-01-02T00:00:00Z", nil, "wombat")
+	insertSearchPost(t, db, "no-hit", "Evening walk", "2024-01-03T00:00:00Z", nil, "koala")
+
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), nil, nil)
+	router := newSearchRouter(t, h, nil)
+
+	// title hits weigh more than tag hits, whatever their age; prefixes match
+	code, page := searchPosts(t, router, url.Values{"q": {"wom"}})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if got := postIDs(page.Items); !slices.Equal(got, []string{"title-hit", "tag-hit"}) {
+		t.Fatalf("items = %v, want [title-hit tag-hit]", got)
+	}
+
+	// every term must match
+	_, page = searchPosts(t, router, url.Values{"q": {"wombat evening"}})
+	if got := postIDs(page.Items); !slices.Equal(got, []string{"tag-hit"}) {
+		t.Fatalf("items = %v, want [tag-hit]", got)
+	}
+}
+
+func TestSearchRankedCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	// equal ranks (ties broken by newest id) and different ones
+	insertSearchPost(t, db, "a", "Numbat", "2024-01-01T00:00:00Z", nil)
+	insertSearchPost(t, db, "b", "Numbat", "2024-01-02T00:00:00Z", nil)
+	insertSearchPost(t, db, "c", "Sleepy numbat in the long grass", "2024-01-03T00:00:00Z", nil)
+	insertSearchPost(t, db, "d", "Lunch", "2024-01-04T00:00:00Z", nil, "numbat")
+	insertSearchPost(t, db, "e", "Numbat", "2024-01-05T00:00:00Z", nil, "numbat")
+
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), nil, nil)
+	router := newSearchRouter(t, h, nil)
+
+	_, all := searchPosts(t, router, url.Values{"q": {"numbat"}, "limit": {"10"}})
+	if len(all.Items) != 5 || all.HasMore {
+		t.Fatalf("single page = %v", postIDs(all.Items))
+	}
+
+	var paged []string
+	query := url.Values{"q": {"numbat"}, "limit": {"2"}}
+	for i := 0; ; i++ {
+		if i > 5 {
+			t.Fatal("pagination does not end")
+		}
+		code, page := searchPosts(t, router, query)
+		if code != http.StatusOK {
+			t.Fatalf("page %d: status = %d", i, code)
+		}
+		paged = append(paged, postIDs(page.Items)...)
+		if !page.HasMore {
+			break
+		}
+		query.Set("cursor", *page.NextCursor)
+	}
+	if want := postIDs(all.Items); !slices.Equal(paged, want) {
+		t.Fatalf("paged = %v, want %v", paged, want)
+	}
+
+	// a ranked cursor doesn't fit the recency order (and vice versa)
+	code, _ := searchPosts(t, router, url.Values{"cursor": {query.Get("cursor")}})
+	if code != http.StatusBadRequest {
+		t.Fatalf("ranked cursor without q: status = %d, want 400", code)
+	}
+}
+
+func TestSearchIndexFollowsEdits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	alice := insertTestUser(t, db, "alice", roleUser)
+	insertSearchPost(t, db, "p", "Platypus", "2024-01-01T00:00:00Z", alice)
+
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), nil, nil)
+	router := newSearchRouter(t, h, alice)
+	search := func(q string) []string {
+		t.Helper()
+		_, page := searchPosts(t, router, url.Values{"q": {q}})
+		return postIDs(page.Items)
+	}
+	do := func(method, body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/posts/p", strings.NewReader(body)))
+		if w.Code >= 300 {
+			t.Fatalf("%s: status = %d %s", method, w.Code, w.Body.String())
+		}
+	}
+
+	do(http.MethodPatch, `{"title":"Echidna","tags":["spiky"]}`)
+	if got := search("platypus"); len(got) != 0 {
+		t.Fatalf("old title still found: %v", got)
+	}
+	if got := search("echidna spiky"); !slices.Equal(got, []string{"p"}) {
+		t.Fatalf("edited post not found: %v", got)
+	}
+
+	do(http.MethodDelete, "")
+	if got := search("echidna"); len(got) != 0 {
+		t.Fatalf("deleted post still found: %v", got)
+	}
+}
+
+// The (rank, id) cursor is only stable while the index doesn't change: bm25 uses index-wide statistics,
+// so a write between two pages moves the ranks the cursor compares against.
+func TestSearchRankedCursorAfterWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	insertSearchPost(t, db, "a", "Quokka", "2024-01-01T00:00:00Z", nil)
+	insertSearchPost(t, db, "b", "Quokka on a beach", "2024-01-02T00:00:00Z", nil)
+	insertSearchPost(t, db, "c", "Lunch", "2024-01-03T00:00:00Z", nil, "quokka")
+
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), nil, nil)
+	router := newSearchRouter(t, h, nil)
+	rank := func(postID string) float64 {
+		t.Helper()
+		var r float64
+		if err := db.QueryRow(
+			`SELECT bm25(posts_fts, 10.0, 5.0) FROM posts_fts WHERE posts_fts MATCH 'quokka' AND rowid = (SELECT id FROM posts WHERE post_id = ?)`,
+			postID,
+		).Scan(&r); err != nil {
+			t.Fatalf("rank of %s: %v", postID, err)
+		}
+		return r
+	}
+
+	_, first := searchPosts(t, router, url.Values{"q": {"quokka"}, "limit": {"1"}})
+	if got := postIDs(first.Items); !slices.Equal(got, []string{"a"}) || !first.HasMore {
+		t.Fatalf("first page = %v", got)
+	}
+	before := rank("a")
+
+	// an unrelated post changes the index statistics, and with them the rank stored in the cursor
+	insertSearchPost(t, db, "d", "A very long title about a wombat and nothing else at all", "2024-01-04T00:00:00Z", nil)
+	if after := rank("a"); after == before {
+		t.Fatalf("rank of a did not change (%v): bm25 no longer depends on the index, update the cursor docs", after)
+	}
+
+	// the cursor is still accepted; the page only lists matches, but may overlap or skip the earlier one
+	code, next := searchPosts(t, router, url.Values{"q": {"quokka"}, "limit": {"5"}, "cursor": {*first.NextCursor}})
+	if code != http.StatusOK {
+		t.Fatalf("next page: status = %d", code)
+	}
+	for _, id := range postIDs(next.Items) {
+		if id == "d" {
+			t.Fatalf("next page lists a post that doesn't match: %v", postIDs(next.Items))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// insertSearchPost inserts a post with tags directly. The search index is not touched:
+// NewPostsHandler rebuilds it, so create the handler after the fixtures.
+func insertSearchPost(t *testing.T, db *sql.DB, postID, title, createdAt string, author *CurrentUser, tags ...string) {
+	t.Helper()
+	var authorID sql.NullInt64
+	if author != nil {
+		authorID = sql.NullInt64{Int64: author.DBID, Valid: true}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(
+		`INSERT INTO posts (post_id, title, image_url, created_at, author_id) VALUES (?, ?, 'http://example.com/a.jpg', ?, ?)`,
+		postID, title, createdAt, authorID,
+	)
+	if err != nil {
+		t.Fatalf("insert post: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	for _, tag := range tags {
+		if err := attachTagTx(context.Background(), tx, id, tag); err != nil {
+			t.Fatalf("attach tag: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+// searchPosts calls GET /posts with query and returns the status and the decoded page.
+func searchPosts(t *testing.T, router *gin.Engine, query url.Values) (int, ListPostsResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/posts?"+query.Encode(), nil))
+	var page ListPostsResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+	}
+	return w.Code, page
+}
+
+func postIDs(items []PostItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.ID)
+	}
+	return ids
+}
+
+func TestSearchLikeFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	insertSearchPost(t, db, "old-title", "Quokka at the beach", "2024-01-01T00:00:00Z", nil)
+	insertSearchPost(t, db, "new-tag", "Holiday", "2024-01-03T00:00:00Z", nil, "quokkas", "beach")
+	insertSearchPost(t, db, "one-word", "Quokka at home", "2024-01-02T00:00:00Z", nil)
+
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), nil, nil)
+	// as if the binary was built without FTS5
+	h.fts = false
+	router := gin.New()
+	router.GET("/posts", h.ListPosts)
+
+	// every term must appear in the title or a tag; newest first
+	code, page := searchPosts(t, router, url.Values{"q": {"#QUOKKA beach!"}})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if got := postIDs(page.Items); len(got) != 2 || got[0] != "new-tag" || got[1] != "old-title" {
+		t.Fatalf("items = %v, want [new-tag old-title]", got)
+	}
+
+	// pages use the (created_at, id) cursor
+	code, page = searchPosts(t, router, url.Values{"q": {"quokka"}, "limit": {"2"}})
+	if code != http.StatusOK || !page.HasMore || page.NextCursor == nil {
+		t.Fatalf("first page: %d %+v", code, page)
+	}
+	code, next := searchPosts(t, router, url.Values{"q": {"quokka"}, "limit": {"2"}, "cursor": {*page.NextCursor}})
+	if got := postIDs(next.Items); code != http.StatusOK || len(got) != 1 || got[0] != "old-title" || next.HasMore {
+		t.Fatalf("second page: %d %v", code, got)
+	}
+}
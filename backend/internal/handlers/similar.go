@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"instagram-lite-backend/internal/imageproc"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSimilarDistance = 10 // out of 64 bits; recompressed or slightly cropped copies stay well below
+	maxSimilarDistance     = 24 // beyond that, unrelated pictures start to match
+)
+
+var errNoPerceptualHash = errors.New("post image has no perceptual hash")
+
+type SimilarPostItem struct {
+	PostItem
+	Distance int `json:"distance"` // Hamming distance of the perceptual hashes; 0 for the same picture
+}
+
+type ListSimilarPostsResponse struct {
+	Items []SimilarPostItem `json:"items"`
+}
+
+// SimilarPosts handler: GET /posts/:id/similar
+// Lists other posts whose image is a near-duplicate of this post's (perceptual hash within max_distance),
+// closest first, e.g. reposts of the same photo with different compression or a slightly different crop.
+// Only posts whose image went through the upload job have a hash.
+func (h *PostsHandler) SimilarPosts(c *gin.Context) {
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	maxDistance := defaultSimilarDistance
+	if s := strings.TrimSpace(c.Query("max_distance")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > maxSimilarDistance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_distance must be between 0 and 24"})
+			return
+		}
+		maxDistance = n
+	}
+
+	ctx := c.Request.Context()
+	matches, err := h.similarPostIDs(ctx, strings.TrimSpace(c.Param("id")), maxDistance, limit)
+	if err != nil {
+		if errors.Is(err, errPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		if errors.Is(err, errNoPerceptualHash) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list similar posts failed"})
+		return
+	}
+
+	ids := make([]int64, len(matches))
+	for i, m := range matches {
+		ids[i] = m.dbID
+	}
+	posts, err := h.loadPostItemsByDBID(ctx, ids, viewerDBID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list similar posts failed"})
+		return
+	}
+
+	items := make([]SimilarPostItem, 0, len(matches))
+	for _, m := range matches {
+		item, ok := posts[m.dbID]
+		if !ok {
+			// deleted in the meantime
+			continue
+		}
+		items = append(items, SimilarPostItem{PostItem: item, Distance: m.distance})
+	}
+
+	c.JSON(http.StatusOK, ListSimilarPostsResponse{Items: items})
+}
+
+type similarMatch struct {
+	dbID     int64
+	distance int
+}
+
+// similarPostIDs compares the post's hash with every other hashed post.
+// SQLite has no popcount, so the distance is computed here; a linear scan of one integer per post
+// is fine at this app's size (index the hash in bands if it ever isn't).
+func (h *PostsHandler) similarPostIDs(ctx context.Context, postID string, maxDistance, limit int) ([]similarMatch, error) {
+	var (
+		postDBID int64
+		hash     sql.NullInt64
+	)
+	err := h.db.QueryRowContext(ctx, `SELECT id, dhash FROM posts WHERE post_id = ?`, postID).Scan(&postDBID, &hash)
+	if err == sql.ErrNoRows {
+		return nil, errPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hash.Valid {
+		return nil, errNoPerceptualHash
+	}
+
+	rows, err := h.db.QueryContext(ctx, `SELECT id, dhash FROM posts WHERE dhash IS NOT NULL AND id <> ?`, postDBID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []similarMatch
+	for rows.Next() {
+		var (
+			id    int64
+			other int64
+		)
+		if err := rows.Scan(&id, &other); err != nil {
+			return nil, err
+		}
+		if d := imageproc.HammingDistance(uint64(hash.Int64), uint64(other)); d <= maxDistance {
+			matches = append(matches, similarMatch{dbID: id, distance: d})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// closest first, then newest
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].dbID > matches[j].dbID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSimilarPosts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	alice := insertTestUser(t, db, "alice", "user")
+	h := NewPostsHandler(db, realtime.NewHub(realtime.NewMemoryBroker()), nil, nil)
+	router := gin.New()
+	router.GET("/posts/:id/similar", h.SimilarPosts)
+
+	for _, p := range []struct {
+		id    string
+		dhash int64
+	}{
+		{"original", 0},
+		{"near-old", 0b1},  // distance 1
+		{"twin", 0},        // distance 0
+		{"cropped", 0b111}, // distance 3
+		{"near-new", 0b10}, // distance 1, newer than near-old
+		{"other", 0xffff},  // distance 16
+	} {
+		insertTestPost(t, db, p.id, alice)
+		if _, err := db.Exec(`UPDATE posts SET dhash = ? WHERE post_id = ?`, p.dhash, p.id); err != nil {
+			t.Fatalf("set dhash: %v", err)
+		}
+	}
+	insertTestPost(t, db, "seeded", nil)
+
+	get := func(path string) (int, ListSimilarPostsResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp ListSimilarPostsResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+	matches := func(resp ListSimilarPostsResponse) []string {
+		var out []string
+		for _, item := range resp.Items {
+			out = append(out, item.ID)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		// closest first, then newest; the post itself is never listed
+		{"/posts/original/similar", []string{"twin", "near-new", "near-old", "cropped"}},
+		{"/posts/original/similar?limit=2", []string{"twin", "near-new"}},
+		{"/posts/original/similar?max_distance=0", []string{"twin"}},
+		{"/posts/original/similar?max_distance=24", []string{"twin", "near-new", "near-old", "cropped", "other"}},
+	} {
+		code, resp := get(tc.path)
+		if code != http.StatusOK || !slices.Equal(matches(resp), tc.want) {
+			t.Errorf("%s: %d %v, want %v", tc.path, code, matches(resp), tc.want)
+		}
+	}
+
+	// the items are full posts with their distance
+	_, resp := get("/posts/original/similar")
+	if first := resp.Items[0]; first.Distance != 0 || first.Title != "t" || first.Author == nil || first.Author.ID != "alice" {
+		t.Errorf("first item = %+v", first)
+	}
+	if resp.Items[3].Distance != 3 {
+		t.Errorf("cropped distance = %d, want 3", resp.Items[3].Distance)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/posts/missing/similar", http.StatusNotFound},
+		{"/posts/seeded/similar", http.StatusUnprocessableEntity},
+		{"/posts/original/similar?max_distance=-1", http.StatusBadRequest},
+		{"/posts/original/similar?max_distance=25", http.StatusBadRequest},
+		{"/posts/original/similar?max_distance=near", http.StatusBadRequest},
+		{"/posts/original/similar?limit=0", http.StatusBadRequest},
+	} {
+		if code, _ := get(tc.path); code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.path, code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/jobs"
+	"instagram-lite-backend/internal/realtime"
+	"instagram-lite-backend/internal/storage"
+)
+
+// jobProcessUpload turns a stored original into the renditions of an upload.
+const jobProcessUpload = "process_upload"
+
+type processUploadPayload struct {
+	UploadID    string            `json:"upload_id"`
+	OriginalKey string            `json:"original_key"`
+	Options     imageproc.Options `json:"options"`
+	Uploader    string            `json:"uploader,omitempty"` // public id of the signed-in uploader, who gets the events
+}
+
+// processUploadJob runs in the job queue's workers. Processing errors (corrupt file, crop outside the image)
+// are permanent; storage errors are retried. The result is what GetUpload returns once the upload is ready.
+func (h *UploadHandler) processUploadJob(ctx context.Context, job jobs.Job) (any, error) {
+	var p processUploadPayload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	original, _, err := h.store.Get(ctx, p.OriginalKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, jobs.Permanent(fmt.Errorf("original %s is gone", p.OriginalKey))
+		}
+		return nil, err
+	}
+
+	// apply the edits, crop the image to an allowed aspect ratio and resize it to every configured width
+	renditions, err := imageproc.ProcessRenditions(bytes.NewReader(original), h.sizes, p.Options)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	// The same picture (with the same edits) was stored before: point this upload at those objects
+	hash := imageproc.ContentHash(renditions)
+	objectID, err := h.shareObjectsByHash(ctx, hash, p.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if objectID == "" {
+		// Store every rendition under a key derived from the upload id,
+		// each format next to the JPEG (uploads/<id>/512.jpg, uploads/<id>/512.webp, ...)
+		objectID = p.UploadID
+		for _, r := range renditions {
+			key := renditionKey(objectID, r.Size)
+			for _, f := range imageproc.OutputFormats {
+				if err := h.store.Put(ctx, formatKey(key, f), r.Files[f], f.ContentType()); err != nil {
+					h.deleteRenditions(ctx, p.UploadID)
+					return nil, fmt.Errorf("storage upload failed: %w", err)
+				}
+			}
+		}
+	}
+
+	images := make(map[string]string, len(renditions))
+	imagesWebP := make(map[string]string, len(renditions))
+	var feed imageproc.Rendition
+	for _, r := range renditions {
+		key := renditionKey(objectID, r.Size)
+		images[strconv.Itoa(r.Size)] = h.store.PublicURL(key)
+		imagesWebP[strconv.Itoa(r.Size)] = h.store.PublicURL(formatKey(key, imageproc.FormatWebP))
+		if r.Size == feedSize(h.sizes) {
+			feed = r
+		}
+	}
+
+	feedURL := images[strconv.Itoa(feed.Size)]
+	if _, err := h.db.ExecContext(
+		ctx,
+		`UPDATE uploads SET image_url = ?, content_hash = ?, object_id = ?, dhash = ?, width = ?, height = ? WHERE upload_id = ?`,
+		feedURL, hash, objectID, int64(feed.DHash), feed.Width, feed.Height, p.UploadID,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := h.store.Delete(ctx, p.OriginalKey); err != nil {
+		log.Printf("delete object %s failed: %v", p.OriginalKey, err)
+	}
+
+	ready := realtime.UploadReady{
+		UploadID:   p.UploadID,
+		ImageURL:   feedURL,
+		Images:     images,
+		ImagesWebP: imagesWebP,
+		Width:      feed.Width,
+		Height:     feed.Height,
+	}
+	h.hub.SendUploadReady(p.Uploader, ready)
+	return ready, nil
+}
+
+// shareObjectsByHash points the upload at the objects of an earlier upload with the same content hash
+// and returns their object id, or "" if there is none whose objects are still stored.
+func (h *UploadHandler) shareObjectsByHash(ctx context.Context, hash, uploadID string) (string, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// Pick the donor and record the reference in one statement: from then on the sweeper and DeletePost
+	// see this upload using the objects. Only uploads still in use qualify, as in the sweeper's check,
+	// so a donor being swept can't be picked.
+	var objectID string
+	err = tx.QueryRowContext(
+		ctx,
+		`UPDATE uploads SET content_hash = ?, object_id = (
+  SELECT object_id FROM uploads
+  WHERE content_hash = ? AND upload_id <> ? AND image_url IS NOT NULL AND `+uploadInUse+`
+  ORDER BY id DESC LIMIT 1
+)
+WHERE upload_id = ? AND EXISTS (
+  SELECT 1 FROM uploads
+  WHERE content_hash = ? AND upload_id <> ? AND image_url IS NOT NULL AND `+uploadInUse+`
+)
+RETURNING object_id`,
+		hash, hash, uploadID, uploadID, hash, uploadID,
+	).Scan(&objectID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	// The objects go away with the last post using them (DeletePost), while claimed upload rows stay.
+	// Deleted before the reference was recorded: store our own.
+	if _, err := h.store.Stat(ctx, renditionKey(objectID, feedSize(h.sizes))); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			return "", err
+		}
+		if _, err := h.db.ExecContext(ctx, `UPDATE uploads SET object_id = upload_id WHERE upload_id = ?`, uploadID); err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+	return objectID, nil
+}
+
+// uploadJobFailed cleans up after an upload that will never be ready and tells the uploader.
+func (h *UploadHandler) uploadJobFailed(job jobs.Job, err error) {
+	var p processUploadPayload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	h.deleteRenditions(ctx, p.UploadID)
+	if err := h.store.Delete(ctx, p.OriginalKey); err != nil {
+		log.Printf("delete object %s failed: %v", p.OriginalKey, err)
+	}
+	h.hub.SendUploadFailed(p.Uploader, p.UploadID, uploadFailedMessage)
+}
+
+// uploadFailedMessage is what clients see; the cause is in the job's last_error and the log.
+const uploadFailedMessage = "image processing failed"
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"instagram-lite-backend/internal/jobs"
+	"instagram-lite-backend/internal/realtime"
+	"instagram-lite-backend/internal/storage"
+)
+
+func TestShareObjectsByHash(t *testing.T) {
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(storage.LocalConfig{Dir: t.TempDir(), PublicBaseURL: "http://localhost/media"})
+	if err != nil {
+		t.Fatalf("local store: %v", err)
+	}
+	queue := jobs.NewQueue(db, jobs.Config{Workers: 1, MaxAttempts: 1, PollInterval: time.Second, BaseBackoff: time.Second, MaxBackoff: time.Second})
+	sizes := []int{150, 512}
+	h := NewUploadHandler(db, store, sizes, queue, realtime.NewHub(realtime.NewMemoryBroker()))
+	ctx := context.Background()
+
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	objectOf := func(uploadID string) string {
+		t.Helper()
+		var objectID string
+		if err := db.QueryRow(`SELECT object_id FROM uploads WHERE upload_id = ?`, uploadID).Scan(&objectID); err != nil {
+			t.Fatalf("upload %s: %v", uploadID, err)
+		}
+		return objectID
+	}
+
+	// an old processed upload nobody posted, the only one using its objects
+	insertTestUpload(t, db, "donor", 48*time.Hour, false)
+	exec(`UPDATE uploads SET content_hash = 'hash', image_url = 'http://localhost/media/x' WHERE upload_id = 'donor'`)
+	feedKey := renditionKey("donor", feedSize(sizes))
+	if err := store.Put(ctx, feedKey, []byte("data"), "image/jpeg"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	insertTestUpload(t, db, "again", time.Minute, false)
+	objectID, err := h.shareObjectsByHash(ctx, "hash", "again")
+	if err != nil || objectID != "donor" || objectOf("again") != "donor" {
+		t.Fatalf("shareObjectsByHash = %q, %v; object_id %q, want donor", objectID, err, objectOf("again"))
+	}
+
+	// the reference is recorded, so sweeping the donor keeps the objects
+	if _, err := NewUploadSweeper(db, store, SweeperConfig{TTL: 24 * time.Hour}).Sweep(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if _, err := store.Stat(ctx, feedKey); err != nil {
+		t.Fatalf("shared objects were swept: %v", err)
+	}
+
+	// a donor the sweeper has claimed is not used
+	insertTestUpload(t, db, "swept", 48*time.Hour, false)
+	exec(`UPDATE uploads SET content_hash = 'other', image_url = 'http://localhost/media/y', claimed_at = ? WHERE upload_id = 'swept'`, claimedBySweeper)
+	if err := store.Put(ctx, renditionKey("swept", feedSize(sizes)), []byte("data"), "image/jpeg"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	insertTestUpload(t, db, "late", time.Minute, false)
+	if objectID, err := h.shareObjectsByHash(ctx, "other", "late"); err != nil || objectID != "" || objectOf("late") != "late" {
+		t.Fatalf("donor being swept: shareObjectsByHash = %q, %v; object_id %q", objectID, err, objectOf("late"))
+	}
+
+	// objects deleted under a recorded donor: the upload gets its own again
+	if err := store.Delete(ctx, feedKey); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	insertTestUpload(t, db, "third", time.Minute, false)
+	exec(`UPDATE uploads SET image_url = 'http://localhost/media/x' WHERE upload_id = 'again'`)
+	if objectID, err := h.shareObjectsByHash(ctx, "hash", "third"); err != nil || objectID != "" || objectOf("third") != "third" {
+		t.Fatalf("objects gone: shareObjectsByHash = %q, %v; object_id %q", objectID, err, objectOf("third"))
+	}
+}
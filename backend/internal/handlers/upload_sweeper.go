@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"instagram-lite-backend/internal/storage"
+)
+
+// SweeperConfig tunes an UploadSweeper, see config.InitUploadSweeper.
+type SweeperConfig struct {
+	TTL      time.Duration // how long an upload may stay unclaimed
+	Interval time.Duration // time between sweeps
+	DryRun   bool          // only log what would be deleted
+}
+
+// sweepBatch bounds the uploads handled per query, so one sweep never holds a huge result set.
+const sweepBatch = 200
+
+// claimedBySweeper is the claimed_at of an upload being swept. Like any claim it stops CreatePost
+// from using the upload; unlike a post's, the sweeper picks it up again until its objects are gone.
+const claimedBySweeper = "sweeping"
+
+// uploadInUse matches uploads whose objects must be kept: not claimed yet (pending or waiting for a post)
+// or claimed by a post that still exists. Content-hash dedupe only shares objects of such uploads.
+const uploadInUse = "(claimed_at IS NULL OR post_db_id IS NOT NULL)"
+
+// UploadSweeper deletes the objects of uploads that no post claimed within the TTL
+// (the user closed the editor, post creation failed, ...), then forgets the upload.
+type UploadSweeper struct {
+	db    *sql.DB
+	store storage.ObjectStore
+	cfg   SweeperConfig
+}
+
+func NewUploadSweeper(db *sql.DB, store storage.ObjectStore, cfg SweeperConfig) *UploadSweeper {
+	return &UploadSweeper{db: db, store: store, cfg: cfg}
+}
+
+// Run sweeps once right away and then every Interval until ctx is done.
+func (s *UploadSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("uploads sweep failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepResult summarizes one sweep.
+type SweepResult struct {
+	Uploads int   // orphaned uploads swept
+	Objects int   // objects deleted (or that would be, in dry-run mode)
+	Bytes   int64 // their total size
+	Errors  int   // objects that could not be deleted; their uploads stay claimed for the next sweep
+}
+
+// Sweep handles every upload that has been unclaimed for longer than the TTL and logs one summary line.
+func (s *UploadSweeper) Sweep(ctx context.Context) (SweepResult, error) {
+	var res SweepResult
+	cutoff := time.Now().Add(-s.cfg.TTL).UTC().Format(time.RFC3339Nano)
+
+	// Keyset over the internal id: dry runs (and failed deletions) leave rows in place.
+	lastID := int64(0)
+	for {
+		batch, err := s.orphans(ctx, cutoff, lastID)
+		if err != nil {
+			return res, err
+		}
+		for _, u := range batch {
+			// Claim the upload before touching storage, so a post can't claim it while its objects go away.
+			// A post that got there first wins and the upload is skipped.
+			if !s.cfg.DryRun {
+				won, err := s.claim(ctx, u.id)
+				if err != nil {
+					return res, err
+				}
+				if !won {
+					continue
+				}
+			}
+			res.Uploads++
+			ok, err := s.sweepUpload(ctx, u, &res)
+			if err != nil {
+				return res, err
+			}
+			if ok && !s.cfg.DryRun {
+				if _, err := s.db.ExecContext(ctx, `DELETE FROM uploads WHERE id = ? AND claimed_at = ?`, u.id, claimedBySweeper); err != nil {
+					return res, err
+				}
+			}
+		}
+		if len(batch) < sweepBatch {
+			break
+		}
+		lastID = batch[len(batch)-1].id
+	}
+
+	mode := ""
+	if s.cfg.DryRun {
+		mode = " (dry run, nothing deleted)"
+	}
+	log.Printf("uploads sweep: %d orphaned upload(s) older than %s, %d object(s), %d byte(s) freed, %d error(s)%s",
+		res.Uploads, s.cfg.TTL, res.Objects, res.Bytes, res.Errors, mode)
+	return res, nil
+}
+
+type orphanUpload struct {
+	id       int64
+	uploadID string
+	objectID string
+}
+
+// orphans returns unclaimed uploads created before cutoff, and those an earlier sweep claimed but could not finish.
+func (s *UploadSweeper) orphans(ctx context.Context, cutoff string, afterID int64) ([]orphanUpload, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, upload_id, object_id FROM uploads
+WHERE (claimed_at IS NULL OR claimed_at = ?) AND created_at < ? AND id > ? ORDER BY id LIMIT ?`,
+		claimedBySweeper, cutoff, afterID, sweepBatch,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []orphanUpload
+	for rows.Next() {
+		var u orphanUpload
+		if err := rows.Scan(&u.id, &u.uploadID, &u.objectID); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// claim marks u as being swept. won is false if a post claimed it first.
+func (s *UploadSweeper) claim(ctx context.Context, id int64) (won bool, err error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE uploads SET claimed_at = ? WHERE id = ? AND (claimed_at IS NULL OR claimed_at = ?)`,
+		claimedBySweeper, id, claimedBySweeper,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// sweepUpload deletes (or in dry-run mode counts) the original and every object under uploads/<object id>/,
+// whatever sizes and formats were configured when it was processed.
+// Objects shared with another upload of the same picture (unclaimed, or used by a post) are left alone.
+// ok is false if an object could not be deleted.
+func (s *UploadSweeper) sweepUpload(ctx context.Context, u orphanUpload, res *SweepResult) (ok bool, err error) {
+	var shared bool
+	if err := s.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (
+  SELECT 1 FROM uploads
+  WHERE object_id = ? AND id <> ? AND `+uploadInUse+`
+)`,
+		u.objectID, u.id,
+	).Scan(&shared); err != nil {
+		return false, err
+	}
+
+	ok = true
+	var objects []storage.ObjectInfo
+	info, err := s.store.Stat(ctx, originalKey(u.uploadID))
+	switch {
+	case err == nil:
+		objects = append(objects, info)
+	case !errors.Is(err, storage.ErrNotFound):
+		log.Printf("stat object %s failed: %v", originalKey(u.uploadID), err)
+		res.Errors++
+		ok = false
+	}
+	if !shared {
+		renditions, err := s.store.List(ctx, renditionPrefix(u.objectID))
+		if err != nil {
+			log.Printf("list objects %s failed: %v", renditionPrefix(u.objectID), err)
+			res.Errors++
+			ok = false
+		}
+		objects = append(objects, renditions...)
+	}
+
+	for _, obj := range objects {
+		if !s.cfg.DryRun {
+			if err := s.store.Delete(ctx, obj.Key); err != nil {
+				log.Printf("delete object %s failed: %v", obj.Key, err)
+				res.Errors++
+				ok = false
+				continue
+			}
+		}
+		res.Objects++
+		res.Bytes += obj.Size
+	}
+	return ok, nil
+}
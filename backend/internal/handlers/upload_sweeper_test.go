@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/storage"
+)
+
+func insertTestUpload(t *testing.T, db *sql.DB, uploadID string, age time.Duration, claimed bool) {
+	t.Helper()
+	createdAt := time.Now().Add(-age).UTC().Format(time.RFC3339Nano)
+	var claimedAt sql.NullString
+	if claimed {
+		claimedAt = sql.NullString{String: createdAt, Valid: true}
+	}
+	if _, err := db.Exec(
+		`INSERT INTO uploads (upload_id, object_id, created_at, claimed_at) VALUES (?, ?, ?, ?)`,
+		uploadID, uploadID, createdAt, claimedAt,
+	); err != nil {
+		t.Fatalf("insert upload: %v", err)
+	}
+}
+
+func TestUploadSweeper(t *testing.T) {
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(storage.LocalConfig{Dir: t.TempDir(), PublicBaseURL: "http://localhost/media"})
+	if err != nil {
+		t.Fatalf("local store: %v", err)
+	}
+	ctx := context.Background()
+
+	put := func(key string) {
+		if err := store.Put(ctx, key, []byte("data"), "image/jpeg"); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	exists := func(key string) bool {
+		_, err := store.Stat(ctx, key)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("stat %s: %v", key, err)
+		}
+		return err == nil
+	}
+
+	// orphan: old, unclaimed, fully processed (2 sizes x 2 formats)
+	insertTestUpload(t, db, "orphan", 48*time.Hour, false)
+	put(renditionKey("orphan", 150))
+	put(formatKey(renditionKey("orphan", 150), imageproc.FormatWebP))
+	put(renditionKey("orphan", 512))
+	put(formatKey(renditionKey("orphan", 512), imageproc.FormatWebP))
+	// a width IMAGE_SIZES no longer lists
+	put(renditionKey("orphan", 1080))
+	// stuck: old, unclaimed, never processed
+	insertTestUpload(t, db, "stuck", 48*time.Hour, false)
+	put(originalKey("stuck"))
+	// claimed by a post, and a fresh one the user may still post
+	insertTestUpload(t, db, "claimed", 48*time.Hour, true)
+	put(renditionKey("claimed", 512))
+	insertTestUpload(t, db, "fresh", time.Minute, false)
+	put(renditionKey("fresh", 512))
+	// old re-upload of the fresh picture, sharing its objects (content-hash dedupe)
+	insertTestUpload(t, db, "alias", 48*time.Hour, false)
+	if _, err := db.Exec(`UPDATE uploads SET object_id = 'fresh' WHERE upload_id = 'alias'`); err != nil {
+		t.Fatalf("alias upload: %v", err)
+	}
+	// claimed by a sweep that could not delete everything
+	insertTestUpload(t, db, "interrupted", 48*time.Hour, false)
+	put(renditionKey("interrupted", 512))
+	if _, err := db.Exec(`UPDATE uploads SET claimed_at = ? WHERE upload_id = 'interrupted'`, claimedBySweeper); err != nil {
+		t.Fatalf("interrupted upload: %v", err)
+	}
+
+	cfg := SweeperConfig{TTL: 24 * time.Hour, Interval: time.Hour, DryRun: true}
+	res, err := NewUploadSweeper(db, store, cfg).Sweep(ctx)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if res.Uploads != 4 || res.Objects != 7 || res.Bytes != 28 || res.Errors != 0 {
+		t.Fatalf("dry run result = %+v", res)
+	}
+	if !exists(renditionKey("orphan", 150)) || !exists(originalKey("stuck")) {
+		t.Fatal("dry run deleted objects")
+	}
+
+	cfg.DryRun = false
+	res, err = NewUploadSweeper(db, store, cfg).Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if res.Uploads != 4 || res.Objects != 7 {
+		t.Fatalf("sweep result = %+v", res)
+	}
+	for _, key := range []string{
+		renditionKey("orphan", 150), renditionKey("orphan", 512), renditionKey("orphan", 1080),
+		originalKey("stuck"), renditionKey("interrupted", 512),
+	} {
+		if exists(key) {
+			t.Errorf("%s should be deleted", key)
+		}
+	}
+	for _, key := range []string{renditionKey("claimed", 512), renditionKey("fresh", 512)} {
+		if !exists(key) {
+			t.Errorf("%s should be kept", key)
+		}
+	}
+
+	var left int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM uploads`).Scan(&left); err != nil {
+		t.Fatalf("count uploads: %v", err)
+	}
+	if left != 2 {
+		t.Fatalf("uploads left = %d, want 2 (claimed, fresh)", left)
+	}
+}
+
+func TestUploadSweeperClaimsBeforeDeleting(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	sweeper := NewUploadSweeper(db, nil, SweeperConfig{TTL: time.Hour})
+
+	insertTestUpload(t, db, "posted", 48*time.Hour, true)
+	insertTestUpload(t, db, "orphan", 48*time.Hour, false)
+	idOf := func(uploadID string) int64 {
+		var id int64
+		if err := db.QueryRow(`SELECT id FROM uploads WHERE upload_id = ?`, uploadID).Scan(&id); err != nil {
+			t.Fatalf("upload %s: %v", uploadID, err)
+		}
+		return id
+	}
+
+	// a post claimed the upload after the sweeper listed it
+	if won, err := sweeper.claim(ctx, idOf("posted")); err != nil || won {
+		t.Fatalf("claim of a posted upload = %v, %v; want lost", won, err)
+	}
+	if won, err := sweeper.claim(ctx, idOf("orphan")); err != nil || !won {
+		t.Fatalf("claim of an orphan = %v, %v; want won", won, err)
+	}
+
+	// and once the sweeper has it, CreatePost can't
+	res, err := db.Exec(`UPDATE uploads SET claimed_at = 'now' WHERE upload_id = 'orphan' AND claimed_at IS NULL`)
+	if err != nil {
+		t.Fatalf("claim for a post: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 0 {
+		t.Fatal("a post claimed an upload being swept")
+	}
+}
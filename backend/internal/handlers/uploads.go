@@ -1,25 +1,70 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/oklog/ulid/v2"
 
 	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/jobs"
+	"instagram-lite-backend/internal/realtime"
 	"instagram-lite-backend/internal/storage"
 )
 
 type UploadHandler struct {
-	uploader *storage.SpacesUploader
+	db    *sql.DB
+	store storage.ObjectStore
+	sizes []int // rendition sizes, see config.ImageSizes
+	queue *jobs.Queue
+	hub   *realtime.Hub
 }
 
-func NewUploadHandler(u *storage.SpacesUploader) *UploadHandler {
-	return &UploadHandler{uploader: u}
+// NewUploadHandler also registers the background processing job with queue.
+func NewUploadHandler(db *sql.DB, s storage.ObjectStore, sizes []int, queue *jobs.Queue, hub *realtime.Hub) *UploadHandler {
+	h := &UploadHandler{db: db, store: s, sizes: sizes, queue: queue, hub: hub}
+	queue.Register(jobProcessUpload, h.processUploadJob, h.uploadJobFailed)
+	return h
 }
 
+const (
+	uploadStatusPending = "pending" // queued or being processed
+	uploadStatusReady   = "ready"
+	uploadStatusFailed  = "failed"
+)
+
+// UploadResponse is returned by Upload (status "pending") and GetUpload.
+// The image fields are set once the status is "ready".
+type UploadResponse struct {
+	UploadID    string            `json:"upload_id"`
+	Status      string            `json:"status"`
+	UploadToken string            `json:"upload_token,omitempty"` // only in the 202 of an anonymous upload, see CreatePostRequest
+	ImageURL    string            `json:"image_url,omitempty"`    // the feed-size rendition
+	Images      map[string]string `json:"images,omitempty"`       // rendition size -> URL
+	ImagesWebP  map[string]string `json:"images_webp,omitempty"`  // rendition size -> URL of its WebP encoding
+	Width       int               `json:"width,omitempty"`        // pixel size of image_url
+	Height      int               `json:"height,omitempty"`
+	Error       string            `json:"error,omitempty"` // why processing failed
+}
+
+// Upload handler: POST /upload
+// Checks and stores the original, then queues the processing; responds 202 with the upload id.
+// Only the uploader can post the upload: the signed-in user, or for anonymous uploads whoever has the upload token.
+// Completion is pushed as an "upload_ready" (or "upload_failed") event to the signed-in uploader's sockets
+// and can be polled via GetUpload.
 func (h *UploadHandler) Upload(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -41,33 +86,252 @@ func (h *UploadHandler) Upload(c *gin.Context) {
 	// ensure file descriptor is released
 	defer f.Close()
 
-	// resize and crop the image to 512 * 512
-	// TODO: move image processing to a background worker if upload throughput becomes a bottleneck
-	jpegBytes, err := imageproc.ProcessJPEG(f)
+	// Optional rotation / crop chosen in the editor
+	opts, err := parseImageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Cheap checks (size, content type, crop bounds) happen here so the client gets a 4xx right away;
+	// decoding errors can only surface in the background job.
+	data, contentType, err := imageproc.ReadUpload(f)
 	if err != nil {
 		if err.Error() == "file too large" {
 			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large"})
 			return
 		}
-		if err.Error() == "decode failed" || err.Error() == "encode failed" {
-			c.JSON(http.StatusBadGateway, gin.H{"error": "image encoding/decoding failed"})
-			return
-		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate image key and upload it to S3
-	// TODO: Add a background job to clean up orphan uploads (images uploaded but never referenced by a post).
+	// A crop outside the image would only fail in the job; the image header is enough to tell now
+	if err := imageproc.CheckOptions(data, opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keep the original until the job has produced the renditions
 	uploadID := ulid.Make().String()
-	key := fmt.Sprintf("uploads/%s.jpg", uploadID)
-	publicURL, err := h.uploader.PutJPEG(ctx, key, jpegBytes)
-	if err != nil {
-		log.Printf("spaces upload failed: %v", err)
+	originalKey := originalKey(uploadID)
+	if err := h.store.Put(ctx, originalKey, data, contentType); err != nil {
+		log.Printf("storage upload failed: %v", err)
 		c.JSON(http.StatusBadGateway, gin.H{"error": "upload image failed"})
 		return
 	}
 
-	// return image URL
-	c.JSON(http.StatusCreated, gin.H{"image_url": publicURL})
+	var (
+		uploaderID  sql.NullInt64
+		uploader    string
+		uploadToken string
+		tokenHash   sql.NullString
+	)
+	if u := currentUser(c); u != nil {
+		uploaderID = sql.NullInt64{Int64: u.DBID, Valid: true}
+		uploader = u.UserID
+	} else {
+		if uploadToken, err = newUploadToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "upload image failed"})
+			return
+		}
+		tokenHash = sql.NullString{String: hashUploadToken(uploadToken), Valid: true}
+	}
+
+	// Record the upload; if no post claims it, UploadSweeper deletes its objects after the TTL
+	if _, err := h.db.ExecContext(
+		ctx,
+		`INSERT INTO uploads (upload_id, object_id, created_at, uploader_id, claim_token_hash) VALUES (?, ?, ?, ?, ?)`,
+		uploadID, uploadID, time.Now().UTC().Format(time.RFC3339Nano), uploaderID, tokenHash,
+	); err != nil {
+		log.Printf("record upload %s failed: %v", uploadID, err)
+		if err := h.store.Delete(ctx, originalKey); err != nil {
+			log.Printf("delete object %s failed: %v", originalKey, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload image failed"})
+		return
+	}
+
+	if _, err := h.queue.Enqueue(ctx, jobProcessUpload, uploadID, processUploadPayload{
+		UploadID:    uploadID,
+		OriginalKey: originalKey,
+		Options:     opts,
+		Uploader:    uploader,
+	}); err != nil {
+		log.Printf("enqueue upload %s failed: %v", uploadID, err)
+		if err := h.store.Delete(ctx, originalKey); err != nil {
+			log.Printf("delete object %s failed: %v", originalKey, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "upload image failed"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, UploadResponse{UploadID: uploadID, Status: uploadStatusPending, UploadToken: uploadToken})
+}
+
+// GetUpload handler: GET /upload/:id
+// Lets clients without a websocket connection poll for the processing result.
+func (h *UploadHandler) GetUpload(c *gin.Context) {
+	uploadID := strings.TrimSpace(c.Param("id"))
+	st, err := h.queue.Lookup(c.Request.Context(), jobProcessUpload, uploadID)
+	if err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "get upload failed"})
+		return
+	}
+
+	resp := UploadResponse{UploadID: uploadID, Status: uploadStatusPending}
+	switch st.Status {
+	case jobs.StatusDone:
+		if err := json.Unmarshal(st.Result, &resp); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "get upload failed"})
+			return
+		}
+		resp.Status = uploadStatusReady
+	case jobs.StatusFailed:
+		resp.Status = uploadStatusFailed
+		resp.Error = uploadFailedMessage
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseImageOptions reads the optional edit fields of the multipart form:
+//   - rotation: degrees clockwise, a multiple of 90
+//   - crop_x, crop_y, crop_w, crop_h: the region to keep (all four or none),
+//     in source pixels or, with crop_unit=normalized, as fractions 0..1 of the (rotated) image
+func parseImageOptions(c *gin.Context) (imageproc.Options, error) {
+	var opts imageproc.Options
+
+	if s := strings.TrimSpace(c.PostForm("rotation")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return opts, errors.New("rotation must be an integer")
+		}
+		opts.Rotation = n
+	}
+
+	fields := []string{"crop_x", "crop_y", "crop_w", "crop_h"}
+	values := make([]float64, 0, len(fields))
+	for _, name := range fields {
+		s := strings.TrimSpace(c.PostForm(name))
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return opts, fmt.Errorf("%s must be a number", name)
+		}
+		values = append(values, v)
+	}
+	switch len(values) {
+	case 0:
+	case len(fields):
+		opts.Crop = &imageproc.CropRect{X: values[0], Y: values[1], W: values[2], H: values[3]}
+		switch unit := strings.TrimSpace(c.PostForm("crop_unit")); unit {
+		case "", "px":
+		case "normalized":
+			opts.Crop.Normalized = true
+		default:
+			return opts, errors.New("crop_unit must be px or normalized")
+		}
+	default:
+		return opts, errors.New("crop_x, crop_y, crop_w and crop_h must be given together")
+	}
+
+	return opts, opts.Validate()
+}
+
+// newUploadToken returns a random secret for an anonymous upload. Only its hash is stored.
+func newUploadToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashUploadToken is what uploads.claim_token_hash holds for token.
+func hashUploadToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// deleteRenditions removes whatever renditions of a failed upload were already stored.
+func (h *UploadHandler) deleteRenditions(ctx context.Context, uploadID string) {
+	for _, size := range h.sizes {
+		deleteObjectFormats(ctx, h.store, renditionKey(uploadID, size))
+	}
+}
+
+// originalKey is where the unprocessed upload waits for its job.
+func originalKey(uploadID string) string {
+	return fmt.Sprintf("originals/%s", uploadID)
+}
+
+// renditionKey is the object key of the JPEG of one width of an upload: "uploads/<upload id>/<size>.jpg".
+// The other formats live next to it, see formatKey.
+func renditionKey(uploadID string, size int) string {
+	return fmt.Sprintf("uploads/%s/%d.jpg", uploadID, size)
+}
+
+// renditionPrefix is the key prefix of every object of an upload (all widths and formats).
+func renditionPrefix(uploadID string) string {
+	return fmt.Sprintf("uploads/%s/", uploadID)
+}
+
+// formatKey is the key of the f encoding of the image stored as jpegKey.
+func formatKey(jpegKey string, f imageproc.Format) string {
+	return strings.TrimSuffix(jpegKey, imageproc.FormatJPEG.Ext()) + f.Ext()
+}
+
+// deleteObjectFormats deletes jpegKey and its other formats. Errors are only logged.
+func deleteObjectFormats(ctx context.Context, store storage.ObjectStore, jpegKey string) {
+	for _, f := range imageproc.OutputFormats {
+		key := formatKey(jpegKey, f)
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("delete object %s failed: %v", key, err)
+		}
+	}
+}
+
+// parseRenditionKey reverses renditionKey. ok is false for keys of any other layout
+// (including single-size uploads made before renditions existed).
+func parseRenditionKey(key string) (uploadID string, size int, ok bool) {
+	rest, ok := strings.CutPrefix(key, "uploads/")
+	if !ok {
+		return "", 0, false
+	}
+	uploadID, file, ok := strings.Cut(rest, "/")
+	if !ok || uploadID == "" {
+		return "", 0, false
+	}
+	sizeStr, ok := strings.CutSuffix(file, ".jpg")
+	if !ok {
+		return "", 0, false
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil || size <= 0 {
+		return "", 0, false
+	}
+	return uploadID, size, true
+}
+
+// feedSize picks the configured size closest to imageproc.FeedSize; its URL is the image_url of an upload.
+func feedSize(sizes []int) int {
+	best := sizes[0]
+	for _, s := range sizes[1:] {
+		if abs(s-imageproc.FeedSize) < abs(best-imageproc.FeedSize) {
+			best = s
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
 }
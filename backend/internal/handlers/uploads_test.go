@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"instagram-lite-backend/internal/imageproc"
+	"instagram-lite-backend/internal/jobs"
+	"instagram-lite-backend/internal/realtime"
+	"instagram-lite-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenditionKeyRoundTrip(t *testing.T) {
+	for _, size := range []int{150, 512, 1080} {
+		key := renditionKey("01JH8ZK9Q6R6YB8Z5Y0S8R4WQ2", size)
+		id, got, ok := parseRenditionKey(key)
+		if !ok || id != "01JH8ZK9Q6R6YB8Z5Y0S8R4WQ2" || got != size {
+			t.Errorf("parseRenditionKey(%q) = %q, %d, %t", key, id, got, ok)
+		}
+	}
+
+	for _, key := range []string{
+		"uploads/abc/512.webp", // other formats are not renditions of their own
+		formatKey(renditionKey("abc", 512), imageproc.FormatWebP),
+		"uploads/abc/large.jpg",
+		"uploads/abc/-5.jpg",
+		"uploads/abc/0.jpg",
+		"uploads//512.jpg",
+		"uploads/abc.jpg", // single-size upload from before renditions
+		"originals/abc",
+		"other/abc/512.jpg",
+	} {
+		if id, size, ok := parseRenditionKey(key); ok {
+			t.Errorf("parseRenditionKey(%q) = %q, %d, want !ok", key, id, size)
+		}
+	}
+}
+
+func TestFeedSize(t *testing.T) {
+	tests := []struct {
+		sizes []int
+		want  int
+	}{
+		{[]int{150, 512, 1080}, 512},
+		{[]int{512}, 512},
+		{[]int{150, 480, 1080}, 480},
+		{[]int{150, 600, 1080}, 600},
+		{[]int{150, 1080}, 150},
+		{[]int{1080}, 1080},
+		{[]int{400, 624}, 400}, // equally far: the smaller one
+	}
+	for _, tt := range tests {
+		if got := feedSize(tt.sizes); got != tt.want {
+			t.Errorf("feedSize(%v) = %d, want %d", tt.sizes, got, tt.want)
+		}
+	}
+}
+
+func TestParseImageOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	crop := func(x, y, w, h float64, normalized bool) *imageproc.CropRect {
+		return &imageproc.CropRect{X: x, Y: y, W: w, H: h, Normalized: normalized}
+	}
+	tests := []struct {
+		name    string
+		form    string
+		want    imageproc.Options
+		wantErr string
+	}{
+		{"nothing", "", imageproc.Options{}, ""},
+		{"rotation", "rotation=90", imageproc.Options{Rotation: 90}, ""},
+		{"negative rotation", "rotation=-90", imageproc.Options{Rotation: -90}, ""},
+		{"full turn", "rotation=360", imageproc.Options{Rotation: 360}, ""},
+		{"rotation 45", "rotation=45", imageproc.Options{}, "rotation must be a multiple of 90"},
+		{"rotation 100", "rotation=100", imageproc.Options{}, "rotation must be a multiple of 90"},
+		{"rotation not a number", "rotation=quarter", imageproc.Options{}, "rotation must be an integer"},
+		{"rotation float", "rotation=90.0", imageproc.Options{}, "rotation must be an integer"},
+		{"pixel crop", "crop_x=10&crop_y=20&crop_w=300&crop_h=400", imageproc.Options{Crop: crop(10, 20, 300, 400, false)}, ""},
+		{"explicit px", "crop_x=0&crop_y=0&crop_w=1&crop_h=1&crop_unit=px", imageproc.Options{Crop: crop(0, 0, 1, 1, false)}, ""},
+		{"normalized crop", "crop_x=0.1&crop_y=0&crop_w=0.8&crop_h=1&crop_unit=normalized", imageproc.Options{Crop: crop(0.1, 0, 0.8, 1, true)}, ""},
+		{"rotation and crop", "rotation=270&crop_x=1&crop_y=2&crop_w=3&crop_h=4", imageproc.Options{Rotation: 270, Crop: crop(1, 2, 3, 4, false)}, ""},
+		{"unit without crop", "crop_unit=normalized", imageproc.Options{}, ""},
+		{"only x", "crop_x=10", imageproc.Options{}, "must be given together"},
+		{"missing h", "crop_x=0&crop_y=0&crop_w=10", imageproc.Options{}, "must be given together"},
+		{"blank field counts as missing", "crop_x=0&crop_y=0&crop_w=10&crop_h=+", imageproc.Options{}, "must be given together"},
+		{"not a number", "crop_x=0&crop_y=0&crop_w=wide&crop_h=10", imageproc.Options{}, "crop_w must be a number"},
+		{"NaN", "crop_x=NaN&crop_y=0&crop_w=10&crop_h=10", imageproc.Options{}, "finite numbers"},
+		{"Inf", "crop_x=0&crop_y=0&crop_w=Inf&crop_h=10", imageproc.Options{}, "finite numbers"},
+		{"unknown unit", "crop_x=0&crop_y=0&crop_w=1&crop_h=1&crop_unit=percent", imageproc.Options{}, "crop_unit must be px or normalized"},
+		{"negative x", "crop_x=-1&crop_y=0&crop_w=10&crop_h=10", imageproc.Options{}, "crop x/y must be >= 0"},
+		{"negative y", "crop_x=0&crop_y=-0.5&crop_w=10&crop_h=10", imageproc.Options{}, "crop x/y must be >= 0"},
+		{"zero width", "crop_x=0&crop_y=0&crop_w=0&crop_h=10", imageproc.Options{}, "w/h > 0"},
+		{"negative height", "crop_x=0&crop_y=0&crop_w=10&crop_h=-10", imageproc.Options{}, "w/h > 0"},
+		{"normalized past the edge", "crop_x=0.5&crop_y=0&crop_w=0.6&crop_h=1&crop_unit=normalized", imageproc.Options{}, "within 0..1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(tt.form))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			got, err := parseImageOptions(c)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if got.Rotation != tt.want.Rotation || (got.Crop == nil) != (tt.want.Crop == nil) ||
+				(got.Crop != nil && *got.Crop != *tt.want.Crop) {
+				t.Fatalf("got %+v (crop %+v), want %+v (crop %+v)", got, got.Crop, tt.want, tt.want.Crop)
+			}
+		})
+	}
+}
+
+// uploadForm builds a multipart POST /upload body with a w x h PNG and the given form fields.
+func uploadForm(t *testing.T, w, h int, fields url.Values) *http.Request {
+	t.Helper()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, v := range values {
+			_ = mw.WriteField(name, v)
+		}
+	}
+	fw, err := mw.CreateFormFile("file", "pic.png")
+	if err != nil {
+		t.Fatalf("form file: %v", err)
+	}
+	_, _ = fw.Write(img.Bytes())
+	if err := mw.Close(); err != nil {
+		t.Fatalf("close form: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadRejectsCropOutsideImage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(storage.LocalConfig{Dir: t.TempDir(), PublicBaseURL: "http://localhost/media"})
+	if err != nil {
+		t.Fatalf("local store: %v", err)
+	}
+	// the queue is never started: accepted uploads just stay pending
+	queue := jobs.NewQueue(db, jobs.Config{Workers: 1, MaxAttempts: 1, PollInterval: time.Second, BaseBackoff: time.Second, MaxBackoff: time.Second})
+	h := NewUploadHandler(db, store, []int{150, 512}, queue, realtime.NewHub(realtime.NewMemoryBroker()))
+	router := gin.New()
+	router.POST("/upload", h.Upload)
+
+	// a 60x40 image, 40x60 once rotated by 90 degrees
+	tests := []struct {
+		name     string
+		fields   url.Values
+		wantCode int
+	}{
+		{"no edits", nil, http.StatusAccepted},
+		{"crop inside", url.Values{"crop_x": {"10"}, "crop_y": {"0"}, "crop_w": {"50"}, "crop_h": {"40"}}, http.StatusAccepted},
+		{"crop past the right edge", url.Values{"crop_x": {"20"}, "crop_y": {"0"}, "crop_w": {"50"}, "crop_h": {"40"}}, http.StatusBadRequest},
+		{"crop past the bottom", url.Values{"crop_x": {"0"}, "crop_y": {"0"}, "crop_w": {"60"}, "crop_h": {"41"}}, http.StatusBadRequest},
+		{"crop fits only unrotated", url.Values{"rotation": {"90"}, "crop_x": {"0"}, "crop_y": {"0"}, "crop_w": {"60"}, "crop_h": {"40"}}, http.StatusBadRequest},
+		{"crop fits the rotated image", url.Values{"rotation": {"90"}, "crop_x": {"0"}, "crop_y": {"0"}, "crop_w": {"40"}, "crop_h": {"60"}}, http.StatusAccepted},
+		{"normalized crop", url.Values{"crop_x": {"0.25"}, "crop_y": {"0"}, "crop_w": {"0.75"}, "crop_h": {"1"}, "crop_unit": {"normalized"}}, http.StatusAccepted},
+		{"crop smaller than a pixel", url.Values{"crop_x": {"0"}, "crop_y": {"0"}, "crop_w": {"0.2"}, "crop_h": {"0.2"}}, http.StatusBadRequest},
+		{"partial crop", url.Values{"crop_x": {"0"}, "crop_y": {"0"}}, http.StatusBadRequest},
+		{"bad rotation", url.Values{"rotation": {"45"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before int
+			_ = db.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&before)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, uploadForm(t, 60, 40, tt.fields))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+
+			var after int
+			_ = db.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&after)
+			if queued := after - before; (tt.wantCode == http.StatusAccepted) != (queued == 1) {
+				t.Fatalf("%d job(s) queued", queued)
+			}
+		})
+	}
+}
+
+func TestUploadCheckMatchesProcessing(t *testing.T) {
+	// whatever CheckOptions lets through, the job must be able to process (and vice versa)
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 60, 40))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	for _, opts := range []imageproc.Options{
+		{Crop: &imageproc.CropRect{X: 59.4, Y: 0, W: 0.6, H: 40}},
+		{Crop: &imageproc.CropRect{X: 59.6, Y: 0, W: 0.6, H: 40}},
+		{Rotation: 270, Crop: &imageproc.CropRect{X: 0, Y: 20, W: 40, H: 40}},
+		{Rotation: 270, Crop: &imageproc.CropRect{X: 0, Y: 21, W: 40, H: 40}},
+	} {
+		checkErr := imageproc.CheckOptions(img.Bytes(), opts)
+		_, processErr := imageproc.ProcessRenditions(bytes.NewReader(img.Bytes()), []int{16}, opts)
+		if (checkErr == nil) != (processErr == nil) {
+			t.Errorf("%+v: CheckOptions = %v, ProcessRenditions = %v", *opts.Crop, checkErr, processErr)
+		}
+		if processErr != nil && !errors.Is(processErr, imageproc.ErrInvalidOptions) {
+			t.Errorf("%+v: %v is not an options error", *opts.Crop, processErr)
+		}
+	}
+}
+
+func TestUploadRecordsUploader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(storage.LocalConfig{Dir: t.TempDir(), PublicBaseURL: "http://localhost/media"})
+	if err != nil {
+		t.Fatalf("local store: %v", err)
+	}
+	queue := jobs.NewQueue(db, jobs.Config{Workers: 1, MaxAttempts: 1, PollInterval: time.Second, BaseBackoff: time.Second, MaxBackoff: time.Second})
+	h := NewUploadHandler(db, store, []int{150, 512}, queue, realtime.NewHub(realtime.NewMemoryBroker()))
+	alice := insertTestUser(t, db, "alice", "user")
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("X-User") == "alice" {
+			c.Set(currentUserKey, alice)
+		}
+	})
+	router.POST("/upload", h.Upload)
+
+	upload := func(user string) (UploadResponse, sql.NullInt64, sql.NullString) {
+		t.Helper()
+		req := uploadForm(t, 60, 40, nil)
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp UploadResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var (
+			uploaderID sql.NullInt64
+			tokenHash  sql.NullString
+		)
+		if err := db.QueryRow(
+			`SELECT uploader_id, claim_token_hash FROM uploads WHERE upload_id = ?`, resp.UploadID,
+		).Scan(&uploaderID, &tokenHash); err != nil {
+			t.Fatalf("select upload: %v", err)
+		}
+		return resp, uploaderID, tokenHash
+	}
+
+	resp, uploaderID, tokenHash := upload("alice")
+	if resp.UploadToken != "" || uploaderID.Int64 != alice.DBID || tokenHash.Valid {
+		t.Errorf("signed-in upload: token %q, uploader %v, token hash %v", resp.UploadToken, uploaderID, tokenHash)
+	}
+
+	resp, uploaderID, tokenHash = upload("")
+	if resp.UploadToken == "" || uploaderID.Valid || tokenHash.String != hashUploadToken(resp.UploadToken) {
+		t.Errorf("anonymous upload: token %q, uploader %v, token hash %v", resp.UploadToken, uploaderID, tokenHash)
+	}
+	if other, _, _ := upload(""); other.UploadToken == resp.UploadToken {
+		t.Errorf("two uploads got the same token")
+	}
+}
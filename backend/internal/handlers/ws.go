@@ -1,41 +1,163 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"instagram-lite-backend/internal/auth"
 	"instagram-lite-backend/internal/realtime"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// wsAuthTimeout is how long a socket that must authenticate may take to send its auth message.
+const wsAuthTimeout = 10 * time.Second
+
+// StreamConfig hardens the websocket and SSE endpoints, see config.InitRealtime.
+type StreamConfig struct {
+	AllowedOrigins []string // browser origins allowed to open a websocket, e.g. "https://app.example.com"; empty or "*" allows any
+	RequireAuth    bool     // reject connections that don't authenticate
+}
+
 type WSHandler struct {
-	hub *realtime.Hub
+	hub      *realtime.Hub
+	auth     *AuthHandler
+	cfg      StreamConfig
+	upgrader websocket.Upgrader
 }
 
-func NewWSHandler(hub *realtime.Hub) *WSHandler {
-	return &WSHandler{hub: hub}
+func NewWSHandler(hub *realtime.Hub, authHandler *AuthHandler, cfg StreamConfig) *WSHandler {
+	h := &WSHandler{hub: hub, auth: authHandler, cfg: cfg}
+	// Upgrade Http to Websocket
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	return h
 }
 
-// Upgrade Http to Websocket
-var upgrader = websocket.Upgrader{
-	// In this homework, simply allow all origins.
-	// In production, we should validate Origin properly.
-	CheckOrigin: func(r *http.Request) bool { return true },
+// checkOrigin lets browsers connect only from the allowed origins. Websockets are not subject to CORS,
+// so without it any page could open one with the visitor's cookies. Requests without an Origin header
+// don't come from a browser and are allowed.
+func (h *WSHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(h.cfg.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range h.cfg.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeWS upgrades the connection. A reconnecting client passes ?since=<seq>&node=<node> (the last event
+// sequence id it saw and the node of its "connected" event) to get the events it missed replayed.
+// A client authenticates with the Authorization header or ?token= on the upgrade request, or with
+// {"type": "auth", "token": "..."} once connected (the first message, if the server requires authentication).
+func (h *WSHandler) ServeWS(c *gin.Context) {
+	since, resume, err := resumePosition(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+		return
+	}
+
+	user, err := h.auth.streamUser(c)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already replied (e.g. 403 for a foreign origin)
+		return
+	}
+
+	client := realtime.NewClient()
+	if user != nil {
+		client.SetUser(user.UserID)
+	} else if h.cfg.RequireAuth {
+		go h.awaitAuth(conn, client, since, resume)
+		return
+	}
+	h.start(conn, client, since, resume)
 }
 
-func (h *WSHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// awaitAuth reads the first message of a socket that must authenticate, and closes the socket unless it is
+// a valid auth message. The client is only registered (and gets events) once authenticated.
+func (h *WSHandler) awaitAuth(conn *websocket.Conn, client *realtime.Client, since realtime.Position, resume bool) {
+	conn.SetReadLimit(4096)
+	_ = conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+
+	var msg realtime.ClientMessage
+	_, data, err := conn.ReadMessage()
+	if err == nil {
+		if json.Unmarshal(data, &msg) != nil || msg.Type != "auth" {
+			err = errors.New("authentication required")
+		}
+	}
+	var userID string
+	if err == nil {
+		userID, err = realtime.VerifyToken(h.auth.VerifyStreamToken, msg.Token)
+	}
 	if err != nil {
-		http.Error(w, "websocket upgrade failed", http.StatusBadRequest)
+		reason := "authentication required"
+		if errors.Is(err, realtime.ErrInvalidToken) {
+			reason = err.Error()
+		}
+		_ = conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+			time.Now().Add(time.Second),
+		)
+		_ = conn.Close()
 		return
 	}
 
-	c := realtime.NewClient(conn)
+	// nobody else writes to the socket before the pumps start
+	_ = conn.SetWriteDeadline(time.Now().Add(wsAuthTimeout))
+	if err := conn.WriteJSON(realtime.Message{Type: "authenticated", Data: realtime.Authenticated{UserID: userID}}); err != nil {
+		log.Printf("ws write failed: %v", err)
+		_ = conn.Close()
+		return
+	}
+	client.SetUser(userID)
+	h.start(conn, client, since, resume)
+}
 
+// start registers the client with the hub and runs its pumps.
+func (h *WSHandler) start(conn *websocket.Conn, client *realtime.Client, since realtime.Position, resume bool) {
 	// Register client with hub.
-	h.hub.Register(c)
+	if resume {
+		h.hub.Resume(client, since)
+	} else {
+		h.hub.Register(client)
+	}
 
 	// Start pumps.
-	go c.WritePump()
-	go c.ReadPump(h.hub)
-}
\ No newline at end of file
+	wc := realtime.NewWSConn(conn, client, h.auth.VerifyStreamToken)
+	go wc.WritePump()
+	go wc.ReadPump(h.hub)
+}
+
+// resumePosition reads ?since=<seq>&node=<node> of a reconnecting client. resume is false without ?since=.
+func resumePosition(c *gin.Context) (since realtime.Position, resume bool, err error) {
+	s := strings.TrimSpace(c.Query("since"))
+	if s == "" {
+		return realtime.Position{}, false, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return realtime.Position{}, false, err
+	}
+	return realtime.Position{Node: strings.TrimSpace(c.Query("node")), Seq: n}, true, nil
+}
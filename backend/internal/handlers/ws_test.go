@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"instagram-lite-backend/internal/auth"
+	"instagram-lite-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// newStreamServer serves GET /ws and GET /events with cfg; token is a valid session token of user "u1".
+func newStreamServer(t *testing.T, cfg StreamConfig) (srv *httptest.Server, token string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	insertTestUser(t, db, "u1", roleUser)
+	signer := auth.NewTokenSigner([]byte("test-secret"), time.Hour)
+	token, _, err := signer.Issue("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := realtime.NewHub(realtime.NewMemoryBroker())
+	authHandler := NewAuthHandler(db, signer)
+	router := gin.New()
+	router.GET("/ws", NewWSHandler(hub, authHandler, cfg).ServeWS)
+	router.GET("/events", NewEventsHandler(hub, authHandler, cfg).ServeEvents)
+	srv = httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv, token
+}
+
+func dialWS(srv *httptest.Server, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	conn, res, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws"+query, header)
+	if conn != nil {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	}
+	return conn, res, err
+}
+
+type wsMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func TestWSOriginAllowList(t *testing.T) {
+	srv, _ := newStreamServer(t, StreamConfig{AllowedOrigins: []string{"https://app.example.com"}})
+
+	for _, tc := range []struct {
+		origin string
+		ok     bool
+	}{
+		{origin: "https://app.example.com", ok: true},
+		{origin: "HTTPS://APP.EXAMPLE.COM", ok: true},
+		{origin: "", ok: true}, // not a browser
+		{origin: "https://evil.example.com", ok: false},
+	} {
+		header := http.Header{}
+		if tc.origin != "" {
+			header.Set("Origin", tc.origin)
+		}
+		conn, res, err := dialWS(srv, "", header)
+		if tc.ok {
+			if err != nil {
+				t.Errorf("origin %q: %v", tc.origin, err)
+				continue
+			}
+			conn.Close()
+			continue
+		}
+		if err == nil {
+			conn.Close()
+			t.Errorf("origin %q: connected, want rejected", tc.origin)
+		} else if res == nil || res.StatusCode != http.StatusForbidden {
+			t.Errorf("origin %q: %v, want 403", tc.origin, err)
+		}
+	}
+}
+
+func TestWSAuthentication(t *testing.T) {
+	srv, token := newStreamServer(t, StreamConfig{RequireAuth: true})
+
+	// token on the upgrade
+	conn, _, err := dialWS(srv, "?token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m wsMessage
+	if err := conn.ReadJSON(&m); err != nil || m.Type != "connected" || !strings.Contains(string(m.Data), `"user_id":"u1"`) {
+		t.Fatalf("got %s %s (%v), want connected as u1", m.Type, m.Data, err)
+	}
+	conn.Close()
+
+	if _, res, err := dialWS(srv, "?token=bogus", nil); err == nil || res == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad token: %v, want 401", err)
+	}
+
+	// token in the first message
+	conn, _, err = dialWS(srv, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(realtime.ClientMessage{Type: "auth", Token: token}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"authenticated", "connected"} {
+		if err := conn.ReadJSON(&m); err != nil || m.Type != want {
+			t.Fatalf("got %s (%v), want %s", m.Type, err, want)
+		}
+	}
+	conn.Close()
+
+	// anything else is rejected
+	for _, first := range []any{
+		realtime.ClientMessage{Type: "subscribe", Tags: []string{"cat"}},
+		realtime.ClientMessage{Type: "auth", Token: "bogus"},
+	} {
+		conn, _, err := dialWS(srv, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteJSON(first); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = conn.ReadMessage()
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != websocket.ClosePolicyViolation {
+			t.Errorf("first message %+v: %v, want a policy violation close", first, err)
+		}
+		conn.Close()
+	}
+
+	// SSE can only authenticate on the request
+	res, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous SSE: status %d, want 401", res.StatusCode)
+	}
+}
+
+func TestWSAnonymousWhenAuthIsOptional(t *testing.T) {
+	srv, token := newStreamServer(t, StreamConfig{})
+
+	conn, _, err := dialWS(srv, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var m wsMessage
+	if err := conn.ReadJSON(&m); err != nil || m.Type != "connected" || strings.Contains(string(m.Data), "user_id") {
+		t.Fatalf("got %s %s (%v), want an anonymous connected", m.Type, m.Data, err)
+	}
+
+	// it can still authenticate later
+	if err := conn.WriteJSON(realtime.ClientMessage{Type: "auth", Token: token}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&m); err != nil || m.Type != "authenticated" || !strings.Contains(string(m.Data), `"user_id":"u1"`) {
+		t.Fatalf("got %s %s (%v), want authenticated as u1", m.Type, m.Data, err)
+	}
+}
@@ -0,0 +1,32 @@
+package imageproc
+
+import (
+	"image"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+)
+
+// DHash is a 64-bit difference hash of img: the image is shrunk to 9x8 gray pixels and each bit
+// says whether a pixel is brighter than its right neighbour. Recompression, resizing and small crops
+// or color changes flip only a few bits, so near-duplicates have a small HammingDistance.
+func DHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Lanczos))
+
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			// gray, so any channel will do
+			if small.Pix[small.PixOffset(x, y)] > small.Pix[small.PixOffset(x+1, y)] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// HammingDistance is the number of differing bits; 0 for identical hashes, up to 64.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,57 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// scene draws a smooth pattern with plenty of structure at 9x8 scale.
+func scene(w, h int, phase float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := 127 + 120*math.Sin(7*fx+phase)*math.Cos(5*fy-phase)
+			img.Set(x, y, color.RGBA{uint8(v), uint8(255 - v), uint8(v / 2), 255})
+		}
+	}
+	return img
+}
+
+func TestDHashNearDuplicates(t *testing.T) {
+	orig := scene(600, 400, 0)
+	want := DHash(orig)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orig, &jpeg.Options{Quality: 20}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	recompressed, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	near := map[string]image.Image{
+		"recompressed": recompressed,
+		"resized":      imaging.Resize(orig, 150, 0, imaging.Box),
+		"cropped":      imaging.Crop(orig, image.Rect(12, 8, 588, 392)),
+	}
+	for name, img := range near {
+		if d := HammingDistance(want, DHash(img)); d > 10 {
+			t.Errorf("%s: distance %d, want <= 10", name, d)
+		}
+	}
+
+	if d := HammingDistance(want, DHash(scene(600, 400, 2))); d < 20 {
+		t.Errorf("different picture: distance %d, want >= 20", d)
+	}
+	if d := HammingDistance(want, DHash(imaging.FlipH(orig))); d < 20 {
+		t.Errorf("mirrored picture: distance %d, want >= 20", d)
+	}
+}
@@ -0,0 +1,49 @@
+package imageproc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestEXIFOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		if got := exifOrientation(readFixture(t, o)); got != o {
+			t.Errorf("orientation_%d.jpg: got %d", o, got)
+		}
+	}
+	if got := exifOrientation(encodePNG(t, 4, 4)); got != 1 {
+		t.Errorf("png: got %d, want 1", got)
+	}
+	if got := exifOrientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF}); got != 1 {
+		t.Errorf("truncated segment: got %d, want 1", got)
+	}
+}
+
+func TestCheckOptionsUsesUprightSize(t *testing.T) {
+	// every fixture displays as 60x40, however it is stored
+	for o := 1; o <= 8; o++ {
+		t.Run(fmt.Sprintf("orientation %d", o), func(t *testing.T) {
+			data := readFixture(t, o)
+			tests := []struct {
+				opts Options
+				ok   bool
+			}{
+				{Options{Crop: &CropRect{X: 0, Y: 0, W: 60, H: 40}}, true},
+				{Options{Crop: &CropRect{X: 0, Y: 0, W: 40, H: 60}}, false},
+				{Options{Rotation: 90, Crop: &CropRect{X: 0, Y: 0, W: 40, H: 60}}, true},
+				{Options{Rotation: -90, Crop: &CropRect{X: 0, Y: 0, W: 60, H: 40}}, false},
+				{Options{Crop: &CropRect{X: 0.5, Y: 0.5, W: 0.5, H: 0.5, Normalized: true}}, true},
+			}
+			for _, tt := range tests {
+				err := CheckOptions(data, tt.opts)
+				if tt.ok && err != nil {
+					t.Errorf("%+v %+v: %v", tt.opts, *tt.opts.Crop, err)
+				}
+				if !tt.ok && !errors.Is(err, ErrInvalidOptions) {
+					t.Errorf("%+v %+v: err = %v, want ErrInvalidOptions", tt.opts, *tt.opts.Crop, err)
+				}
+			}
+		})
+	}
+}
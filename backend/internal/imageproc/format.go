@@ -0,0 +1,57 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	// input formats beyond image/jpeg and image/png
+	_ "image/gif"
+
+	"github.com/chai2010/webp" // also registers the WebP decoder
+)
+
+// Format is an output encoding of a rendition.
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+)
+
+// OutputFormats are encoded for every rendition. JPEG comes first: it is the
+// universal fallback and the format of image_url.
+// Adding a format (e.g. AVIF) means adding it here, to encoders and to formatInfo.
+var OutputFormats = []Format{FormatJPEG, FormatWebP}
+
+var formatInfo = map[Format]struct{ ext, contentType string }{
+	FormatJPEG: {".jpg", "image/jpeg"},
+	FormatWebP: {".webp", "image/webp"},
+}
+
+// Ext is the file extension for object keys, including the dot.
+func (f Format) Ext() string { return formatInfo[f].ext }
+
+// ContentType is the MIME type the format is stored and served with.
+func (f Format) ContentType() string { return formatInfo[f].contentType }
+
+// acceptedInputTypes are the sniffed content types ProcessRenditions decodes.
+var acceptedInputTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/gif":  true, // first frame only
+}
+
+// encoders write img in one format. Neither writes any metadata (EXIF etc.).
+var encoders = map[Format]func(img image.Image) ([]byte, error){
+	FormatJPEG: func(img image.Image) ([]byte, error) {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+		return buf.Bytes(), err
+	},
+	FormatWebP: func(img image.Image) ([]byte, error) {
+		// lossy WebP at this quality is typically 25-35% smaller than the JPEG above
+		return webp.EncodeRGB(img, 80)
+	},
+}
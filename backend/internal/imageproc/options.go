@@ -0,0 +1,125 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// ErrInvalidOptions wraps every validation error of Options.
+var ErrInvalidOptions = errors.New("invalid image options")
+
+// Options are the client's edits, applied before the aspect-ratio crop and resize.
+// The zero value leaves the image untouched.
+type Options struct {
+	// Rotation in degrees clockwise; a multiple of 90.
+	Rotation int `json:"rotation,omitempty"`
+	// Crop selects the region to keep, in coordinates of the rotated image. nil keeps everything.
+	Crop *CropRect `json:"crop,omitempty"`
+}
+
+// CropRect is a rectangle in source pixels, or in fractions (0..1) of the
+// image size when Normalized is set.
+type CropRect struct {
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	W          float64 `json:"w"`
+	H          float64 `json:"h"`
+	Normalized bool    `json:"normalized,omitempty"`
+}
+
+// Validate checks everything that doesn't depend on the image itself.
+func (o Options) Validate() error {
+	if o.Rotation%90 != 0 {
+		return fmt.Errorf("%w: rotation must be a multiple of 90", ErrInvalidOptions)
+	}
+	if c := o.Crop; c != nil {
+		for _, v := range []float64{c.X, c.Y, c.W, c.H} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("%w: crop values must be finite numbers", ErrInvalidOptions)
+			}
+		}
+		if c.X < 0 || c.Y < 0 || c.W <= 0 || c.H <= 0 {
+			return fmt.Errorf("%w: crop x/y must be >= 0 and w/h > 0", ErrInvalidOptions)
+		}
+		if c.Normalized && (c.X+c.W > 1 || c.Y+c.H > 1) {
+			return fmt.Errorf("%w: normalized crop must lie within 0..1", ErrInvalidOptions)
+		}
+	}
+	return nil
+}
+
+// apply rotates img and then crops it, returning an error when the crop
+// rectangle doesn't fit into the rotated image.
+func (o Options) apply(img image.Image) (image.Image, error) {
+	// imaging rotates counter-clockwise
+	switch ((o.Rotation % 360) + 360) % 360 {
+	case 90:
+		img = imaging.Rotate270(img)
+	case 180:
+		img = imaging.Rotate180(img)
+	case 270:
+		img = imaging.Rotate90(img)
+	}
+
+	if o.Crop == nil {
+		return img, nil
+	}
+	rect, err := o.cropRect(img.Bounds())
+	if err != nil {
+		return nil, err
+	}
+	return imaging.Crop(img, rect), nil
+}
+
+// cropRect converts the crop to pixels of an image with bounds b (already rotated)
+// and checks that it fits.
+func (o Options) cropRect(b image.Rectangle) (image.Rectangle, error) {
+	c := o.Crop
+	x, y, w, h := c.X, c.Y, c.W, c.H
+	if c.Normalized {
+		x, w = x*float64(b.Dx()), w*float64(b.Dx())
+		y, h = y*float64(b.Dy()), h*float64(b.Dy())
+	}
+	rect := image.Rect(
+		int(math.Round(x)), int(math.Round(y)),
+		int(math.Round(x+w)), int(math.Round(y+h)),
+	).Add(b.Min)
+	if rect.Empty() {
+		return image.Rectangle{}, fmt.Errorf("%w: crop is smaller than one pixel", ErrInvalidOptions)
+	}
+	if !rect.In(b) {
+		return image.Rectangle{}, fmt.Errorf("%w: crop exceeds the %dx%d image", ErrInvalidOptions, b.Dx(), b.Dy())
+	}
+	return rect, nil
+}
+
+// CheckOptions validates opts against the upload data without decoding the pixels: only the image header
+// (and, for JPEGs, the EXIF orientation) is read, so handlers can reject a crop outside the image
+// before queueing the actual processing. The errors are the ones ProcessRenditions would fail with.
+func CheckOptions(data []byte, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if opts.Crop == nil {
+		return nil
+	}
+	cfg, ct, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decode failed")
+	}
+	w, h := cfg.Width, cfg.Height
+	// the same order as ProcessRenditions: upright first, then the client's rotation
+	if ct == "jpeg" && exifOrientation(data) >= 5 {
+		w, h = h, w
+	}
+	if r := ((opts.Rotation % 360) + 360) % 360; r == 90 || r == 270 {
+		w, h = h, w
+	}
+	_, err = opts.cropRect(image.Rect(0, 0, w, h))
+	return err
+}
@@ -0,0 +1,88 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		ok   bool
+	}{
+		{"zero value", Options{}, true},
+		{"rotation 90", Options{Rotation: 90}, true},
+		{"rotation 180", Options{Rotation: 180}, true},
+		{"rotation 270", Options{Rotation: 270}, true},
+		{"rotation -90", Options{Rotation: -90}, true},
+		{"rotation 450", Options{Rotation: 450}, true},
+		{"rotation 45", Options{Rotation: 45}, false},
+		{"rotation 1", Options{Rotation: 1}, false},
+		{"rotation -30", Options{Rotation: -30}, false},
+		{"pixel crop", Options{Crop: &CropRect{X: 0, Y: 0, W: 10, H: 10}}, true},
+		{"pixel crop beyond 1 is fine", Options{Crop: &CropRect{X: 5, Y: 5, W: 500, H: 500}}, true},
+		{"zero width", Options{Crop: &CropRect{W: 0, H: 10}}, false},
+		{"zero height", Options{Crop: &CropRect{W: 10, H: 0}}, false},
+		{"negative width", Options{Crop: &CropRect{W: -10, H: 10}}, false},
+		{"negative height", Options{Crop: &CropRect{W: 10, H: -1}}, false},
+		{"negative x", Options{Crop: &CropRect{X: -1, W: 10, H: 10}}, false},
+		{"negative y", Options{Crop: &CropRect{Y: -1, W: 10, H: 10}}, false},
+		{"NaN", Options{Crop: &CropRect{X: math.NaN(), W: 10, H: 10}}, false},
+		{"Inf", Options{Crop: &CropRect{W: math.Inf(1), H: 10}}, false},
+		{"normalized", Options{Crop: &CropRect{X: 0.25, Y: 0, W: 0.75, H: 1, Normalized: true}}, true},
+		{"normalized past the right edge", Options{Crop: &CropRect{X: 0.5, W: 0.6, H: 1, Normalized: true}}, false},
+		{"normalized past the bottom", Options{Crop: &CropRect{Y: 0.1, W: 1, H: 1, Normalized: true}}, false},
+		{"normalized zero size", Options{Crop: &CropRect{W: 0, H: 1, Normalized: true}}, false},
+	}
+	for _, tt := range tests {
+		err := tt.opts.Validate()
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: err = %v, want ErrInvalidOptions", tt.name, err)
+		}
+	}
+}
+
+func TestProcessRenditionsRotatesBeforeCropping(t *testing.T) {
+	// orientation_1.jpg is 60x40: red | green over blue | white, each quadrant 30x20.
+	// Turned 90 degrees clockwise it is 40x60: blue | red over white | green, so the
+	// same crop picks a different quadrant depending on whether rotation ran first.
+	crop := &CropRect{X: 2, Y: 2, W: 16, H: 16}
+	tests := []struct {
+		name string
+		opts Options
+		want color.RGBA
+	}{
+		{"no rotation", Options{Crop: crop}, color.RGBA{255, 0, 0, 255}},
+		{"rotation 90", Options{Rotation: 90, Crop: crop}, color.RGBA{0, 0, 255, 255}},
+		{"rotation 180", Options{Rotation: 180, Crop: crop}, color.RGBA{255, 255, 255, 255}},
+		{"rotation 270", Options{Rotation: 270, Crop: crop}, color.RGBA{0, 255, 0, 255}},
+		{"rotation 90, normalized", Options{Rotation: 90, Crop: &CropRect{X: 0.55, Y: 0.55, W: 0.4, H: 0.25, Normalized: true}}, color.RGBA{0, 255, 0, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ProcessRenditions(bytes.NewReader(readFixture(t, 1)), []int{100}, tt.opts)
+			if err != nil {
+				t.Fatalf("process: %v", err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(out[0].JPEG()))
+			if err != nil {
+				t.Fatalf("decode output: %v", err)
+			}
+			// the crop is a single quadrant: every pixel has its color
+			b := img.Bounds()
+			for _, p := range [][2]int{{b.Min.X + 2, b.Min.Y + 2}, {b.Max.X - 3, b.Max.Y - 3}, {(b.Min.X + b.Max.X) / 2, (b.Min.Y + b.Max.Y) / 2}} {
+				if got := img.At(p[0], p[1]); !closeTo(got, tt.want) {
+					t.Errorf("pixel %v = %v, want %v", p, got, tt.want)
+				}
+			}
+		})
+	}
+}
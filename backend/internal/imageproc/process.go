@@ -2,11 +2,12 @@ package imageproc
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
-	"image/jpeg"
 	"io"
 	"net/http"
 
@@ -17,52 +18,145 @@ const (
 	MaxUploadBytes = int64(10 << 20) // 10MB
 )
 
+// FeedSize is the width of the rendition shown in the feed (and returned as image_url).
+const FeedSize = 512
+
+// DefaultSizes are the renditions produced when no sizes are configured:
+// grid thumbnail, feed and detail view.
+var DefaultSizes = []int{150, FeedSize, 1080}
+
+// Rendition is one processed size of an uploaded image, encoded in every OutputFormats format.
+type Rendition struct {
+	Size   int // requested width; the encoded image is narrower when the source is
+	Width  int
+	Height int
+	Files  map[Format][]byte
+	DHash  uint64 // perceptual hash, see DHash
+}
+
+// JPEG returns the JPEG encoding, which every rendition has.
+func (r Rendition) JPEG() []byte { return r.Files[FormatJPEG] }
+
+// ContentHash is the hex SHA-256 of every encoded file of renditions, in order.
+// The encoders are deterministic, so the same picture processed with the same options and sizes
+// always hashes the same, whatever the uploaded file's name or metadata.
+func ContentHash(renditions []Rendition) string {
+	h := sha256.New()
+	for _, r := range renditions {
+		for _, f := range OutputFormats {
+			h.Write(r.Files[f])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ProcessJPEG produces the single FeedSize wide JPEG.
 func ProcessJPEG(r io.Reader) ([]byte, error) {
+	out, err := ProcessRenditions(r, []int{FeedSize}, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return out[0].JPEG(), nil
+}
+
+// ProcessRenditions decodes the image once, applies opts (rotation, then the client's crop),
+// center-crops the result to the nearest of AllowedRatios and encodes one Rendition per requested width,
+// in the order of sizes. Input may be JPEG, PNG, WebP or GIF.
+// Images are never upscaled: a size wider than the cropped source is encoded at the source size.
+// Invalid opts fail with an error wrapping ErrInvalidOptions.
+func ProcessRenditions(r io.Reader, sizes []int, opts Options) ([]Rendition, error) {
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no sizes requested")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	data, ct, err := ReadUpload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert bytes into image.Image for cropping and resizing.
+	img, err := decode(data, ct)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply the client's rotation and crop (see options.go)
+	img, err = opts.apply(img)
+	if err != nil {
+		return nil, err
+	}
+
+	// center crop to the closest allowed aspect ratio (see ratio.go)
+	cropped := cropToRatio(img, NearestRatio(img.Bounds().Dx(), img.Bounds().Dy()))
+	srcWidth := cropped.Bounds().Dx()
+
+	out := make([]Rendition, 0, len(sizes))
+	for _, s := range sizes {
+		// height 0 keeps the cropped aspect ratio
+		resized := imaging.Resize(cropped, min(s, srcWidth), 0, imaging.Lanczos)
+
+		// after cropping and resizing, we need to encode it back (see format.go).
+		// The encoders write no EXIF (or any other metadata), so GPS position, camera model etc. of the original are dropped.
+		files := make(map[Format][]byte, len(OutputFormats))
+		for _, f := range OutputFormats {
+			b, err := encoders[f](resized)
+			if err != nil {
+				return nil, fmt.Errorf("encode failed")
+			}
+			files[f] = b
+		}
+		out = append(out, Rendition{
+			Size:   s,
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+			Files:  files,
+			DHash:  DHash(resized),
+		})
+	}
+	return out, nil
+}
+
+
+// ReadUpload reads the raw upload and checks its size and (sniffed) content type,
+// without decoding it. The errors are the same as ProcessRenditions'.
+func ReadUpload(r io.Reader) ([]byte, string, error) {
 	// Check size
 	// Although we have http.MaxBytesReader in handler, this limit reader here is to keep this function safe without depending on the handler. e.g. Unit Test
 	lr := &io.LimitedReader{R: r, N: MaxUploadBytes + 1}
 	data, err := io.ReadAll(lr)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	if int64(len(data)) > MaxUploadBytes {
-		return nil, fmt.Errorf("file too large")
+		return nil, "", fmt.Errorf("file too large")
 	}
 
 	// Check Type. 
 	ct := http.DetectContentType(head512(data))
-	if ct != "image/jpeg" && ct != "image/png" {
-		return nil, fmt.Errorf("unsupported content-type: %s", ct)
+	if !acceptedInputTypes[ct] {
+		return nil, "", fmt.Errorf("unsupported content-type: %s", ct)
 	}
+	return data, ct, nil
+}
 
-	// Convert bytes into image.Image for cropping and resizing.
-	img, _, err := image.Decode(bytes.NewReader(data))
+// decode turns the uploaded bytes into an upright image.
+// JPEGs are rotated/flipped according to their EXIF Orientation tag (phones store portrait shots
+// sideways and rely on it); the tag itself is not carried over, since the pixels are now upright.
+func decode(data []byte, ct string) (image.Image, error) {
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
 	if err != nil {
 		return nil, fmt.Errorf("decode failed")
 	}
 
 	// For png image file, we need to normalize its transaparent background.
-	//  PNG may contain alpha; JPEG doesn't support transparency.
-	if ct == "image/png" {
+	//  PNG (and GIF / WebP) may contain alpha; JPEG doesn't support transparency.
+	if ct != "image/jpeg" {
 		img = normalizeBgForPng(img)
 	}
-
-	// center crop square + resize
-	w := img.Bounds().Dx()
-	h := img.Bounds().Dy()
-	// the shortest size will be the square size
-	size := min(w, h)
-	// crop a square shape from the center.
-	square := imaging.CropCenter(img, size, size)
-	// resize it to 512 * 512
-	out := imaging.Resize(square, 512, 512, imaging.Lanczos)
-
-	// after cropping and resizing, we need to encode it back. 
-	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: 90}); err != nil {
-		return nil, fmt.Errorf("encode failed")
-	}
-	return buf.Bytes(), nil
+	return img, nil
 }
 
 
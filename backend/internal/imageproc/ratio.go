@@ -0,0 +1,45 @@
+package imageproc
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Allowed width/height ratios, as on Instagram.
+const (
+	RatioSquare    = 1.0     // 1:1
+	RatioPortrait  = 4.0 / 5 // 4:5
+	RatioLandscape = 1.91    // 1.91:1
+)
+
+// AllowedRatios are the aspect ratios uploads are cropped to.
+var AllowedRatios = []float64{RatioSquare, RatioPortrait, RatioLandscape}
+
+// NearestRatio returns the allowed ratio closest to w:h.
+// Distance is measured on a log scale so that e.g. 2:1 and 1:2 are equally far from 1:1.
+func NearestRatio(w, h int) float64 {
+	r := math.Log(float64(w) / float64(h))
+	best := AllowedRatios[0]
+	for _, a := range AllowedRatios[1:] {
+		if math.Abs(r-math.Log(a)) < math.Abs(r-math.Log(best)) {
+			best = a
+		}
+	}
+	return best
+}
+
+// cropToRatio center-crops img to the largest region with the given width/height ratio.
+func cropToRatio(img image.Image, ratio float64) image.Image {
+	w := img.Bounds().Dx()
+	h := img.Bounds().Dy()
+	if float64(w)/float64(h) > ratio {
+		// too wide: keep the full height
+		w = max(1, int(math.Round(float64(h)*ratio)))
+	} else {
+		// too tall: keep the full width
+		h = max(1, int(math.Round(float64(w)/ratio)))
+	}
+	return imaging.CropCenter(img, w, h)
+}
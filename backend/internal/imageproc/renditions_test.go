@@ -0,0 +1,73 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/chai2010/webp"
+)
+
+// encodePNG returns a w x h PNG with a gradient, so resized renditions differ in content.
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessRenditionsSizes(t *testing.T) {
+	// 400x500 is exactly 4:5, so nothing is cropped
+	out, err := ProcessRenditions(bytes.NewReader(encodePNG(t, 400, 500)), []int{150, 512, 1080}, Options{})
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	want := []struct{ size, w, h int }{
+		{150, 150, 188},
+		{512, 400, 500},  // never upscaled
+		{1080, 400, 500}, // never upscaled
+	}
+	if len(out) != len(want) {
+		t.Fatalf("got %d renditions, want %d", len(out), len(want))
+	}
+	for i, w := range want {
+		r := out[i]
+		if r.Size != w.size || r.Width != w.w || r.Height != w.h {
+			t.Errorf("rendition %d = %d: %dx%d, want %d: %dx%d", i, r.Size, r.Width, r.Height, w.size, w.w, w.h)
+		}
+		// the encoded files have the reported size
+		jpg, _, err := image.DecodeConfig(bytes.NewReader(r.JPEG()))
+		if err != nil {
+			t.Fatalf("decode jpeg: %v", err)
+		}
+		wp, err := webp.DecodeConfig(bytes.NewReader(r.Files[FormatWebP]))
+		if err != nil {
+			t.Fatalf("decode webp: %v", err)
+		}
+		for name, cfg := range map[string]image.Config{"jpeg": jpg, "webp": wp} {
+			if cfg.Width != w.w || cfg.Height != w.h {
+				t.Errorf("%d %s is %dx%d, want %dx%d", w.size, name, cfg.Width, cfg.Height, w.w, w.h)
+			}
+		}
+	}
+}
+
+func TestProcessRenditionsErrors(t *testing.T) {
+	if _, err := ProcessRenditions(bytes.NewReader(encodePNG(t, 10, 10)), nil, Options{}); err == nil {
+		t.Error("no sizes: expected an error")
+	}
+	if _, err := ProcessRenditions(bytes.NewReader([]byte("not an image")), []int{16}, Options{}); err == nil {
+		t.Error("text input: expected an error")
+	}
+}
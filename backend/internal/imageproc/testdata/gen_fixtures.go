@@ -0,0 +1,117 @@
+//go:build ignore
+
+// gen_fixtures writes orientation_1.jpg ... orientation_8.jpg: the same upright
+// 60x40 image (red, green / blue, white quadrants) stored the way a camera would for
+// each EXIF Orientation value, with an EXIF block that also carries Make, Model and GPS tags.
+//
+//	cd internal/imageproc && go run testdata/gen_fixtures.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+)
+
+func main() {
+	upright := imaging.New(60, 40, color.White)
+	fill := func(x0, y0 int, c color.Color) {
+		for y := y0; y < y0+20; y++ {
+			for x := x0; x < x0+30; x++ {
+				upright.Set(x, y, c)
+			}
+		}
+	}
+	fill(0, 0, color.RGBA{255, 0, 0, 255})
+	fill(30, 0, color.RGBA{0, 255, 0, 255})
+	fill(0, 20, color.RGBA{0, 0, 255, 255})
+
+	// stored[o] is what a viewer must transform with orientation o to get the upright image
+	stored := map[int]image.Image{
+		1: upright,
+		2: imaging.FlipH(upright),
+		3: imaging.Rotate180(upright),
+		4: imaging.FlipV(upright),
+		5: imaging.Transpose(upright),
+		6: imaging.Rotate90(upright), // displayed rotated 90 clockwise
+		7: imaging.Transverse(upright),
+		8: imaging.Rotate270(upright), // displayed rotated 90 counter-clockwise
+	}
+
+	for o := 1; o <= 8; o++ {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, stored[o], &jpeg.Options{Quality: 95}); err != nil {
+			log.Fatal(err)
+		}
+		raw := buf.Bytes()
+		// SOI, then our APP1, then the rest of the encoder output
+		out := append([]byte{}, raw[:2]...)
+		out = append(out, exifSegment(uint16(o))...)
+		out = append(out, raw[2:]...)
+
+		name := filepath.Join("testdata", fmt.Sprintf("orientation_%d.jpg", o))
+		if err := os.WriteFile(name, out, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// exifSegment builds a big-endian APP1 Exif segment with IFD0 {Make, Model, Orientation, GPS IFD pointer}
+// and a GPS IFD {GPSLatitudeRef, GPSLatitude}.
+func exifSegment(orientation uint16) []byte {
+	be := binary.BigEndian
+	const (
+		ifd0Off    = 8
+		ifd0Len    = 2 + 4*12 + 4
+		makeOff    = ifd0Off + ifd0Len
+		makeVal    = "FixtureCam\x00"
+		modelOff   = makeOff + len(makeVal)
+		modelVal   = "Model X1000\x00"
+		gpsIFDOff  = modelOff + len(modelVal)
+		gpsIFDLen  = 2 + 2*12 + 4
+		latOff     = gpsIFDOff + gpsIFDLen
+		tiffLength = latOff + 3*8
+	)
+
+	tiff := make([]byte, tiffLength)
+	copy(tiff, "MM")
+	be.PutUint16(tiff[2:], 42)
+	be.PutUint32(tiff[4:], ifd0Off)
+
+	entry := func(at int, tag, typ uint16, count uint32, value []byte) {
+		be.PutUint16(tiff[at:], tag)
+		be.PutUint16(tiff[at+2:], typ)
+		be.PutUint32(tiff[at+4:], count)
+		copy(tiff[at+8:at+12], value)
+	}
+	u32 := func(v uint32) []byte { b := make([]byte, 4); be.PutUint32(b, v); return b }
+	u16 := func(v uint16) []byte { b := make([]byte, 4); be.PutUint16(b, v); return b }
+
+	be.PutUint16(tiff[ifd0Off:], 4)
+	entry(ifd0Off+2, 0x010F, 2, uint32(len(makeVal)), u32(uint32(makeOff)))    // Make
+	entry(ifd0Off+14, 0x0110, 2, uint32(len(modelVal)), u32(uint32(modelOff))) // Model
+	entry(ifd0Off+26, 0x0112, 3, 1, u16(orientation))                          // Orientation
+	entry(ifd0Off+38, 0x8825, 4, 1, u32(uint32(gpsIFDOff)))                    // GPS IFD pointer
+	copy(tiff[makeOff:], makeVal)
+	copy(tiff[modelOff:], modelVal)
+
+	be.PutUint16(tiff[gpsIFDOff:], 2)
+	entry(gpsIFDOff+2, 0x0001, 2, 2, []byte("N\x00"))      // GPSLatitudeRef
+	entry(gpsIFDOff+14, 0x0002, 5, 3, u32(uint32(latOff))) // GPSLatitude
+	for i, v := range []uint32{52, 1, 31, 1, 1234, 100} {  // 52° 31' 12.34"
+		be.PutUint32(tiff[latOff+4*i:], v)
+	}
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	be.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
@@ -0,0 +1,338 @@
+// Package jobs is a small durable job queue stored in SQLite.
+//
+// Jobs survive restarts: a job is only marked done after its handler returned,
+// and jobs left "running" by a crashed process are picked up again on Start.
+// A failed attempt is retried with exponential backoff until MaxAttempts;
+// handlers return a Permanent error to give up right away.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// ErrNotFound is returned by Lookup when no job matches.
+var ErrNotFound = errors.New("job not found")
+
+// Job is one claimed job as passed to a Handler.
+type Job struct {
+	ID          int64
+	Kind        string
+	Ref         string
+	Payload     []byte
+	Attempt     int // 1 for the first run
+	MaxAttempts int
+}
+
+// Handler processes one job. The returned result (may be nil) is stored as JSON.
+type Handler func(ctx context.Context, job Job) (result any, err error)
+
+// FailureHook is called once a job has failed for good (permanent error or out of attempts).
+type FailureHook func(job Job, err error)
+
+// Config tunes a Queue. Zero values fall back to the defaults below.
+type Config struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration // how often idle workers look for due jobs
+	BaseBackoff  time.Duration // delay before the 2nd attempt; doubles per attempt
+	MaxBackoff   time.Duration
+}
+
+const (
+	defaultWorkers      = 2
+	defaultMaxAttempts  = 5
+	defaultPollInterval = time.Second
+	defaultBaseBackoff  = 2 * time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+)
+
+type Queue struct {
+	db       *sql.DB
+	cfg      Config
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	onFail   map[string]FailureHook
+	wake     chan struct{}
+}
+
+func NewQueue(db *sql.DB, cfg Config) *Queue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaultBaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	return &Queue{
+		db:       db,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+		onFail:   make(map[string]FailureHook),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler for kind; onFail may be nil. Call before Start.
+func (q *Queue) Register(kind string, h Handler, onFail FailureHook) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+	if onFail != nil {
+		q.onFail[kind] = onFail
+	}
+}
+
+// Enqueue stores a new job; payload is marshaled to JSON. ref is an optional id for Lookup.
+func (q *Queue) Enqueue(ctx context.Context, kind, ref string, payload any) (int64, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	res, err := q.db.ExecContext(
+		ctx,
+		`INSERT INTO jobs (kind, ref, payload, max_attempts, run_at) VALUES (?, ?, ?, ?, ?)`,
+		kind, ref, string(b), q.cfg.MaxAttempts, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	// Let an idle worker pick it up without waiting for the next poll.
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return res.LastInsertId()
+}
+
+// Status is the externally visible state of a job.
+type Status struct {
+	Status    string
+	Attempts  int
+	LastError string
+	Result    []byte // JSON, set when done
+}
+
+// Lookup returns the state of the newest job of kind with the given ref.
+func (q *Queue) Lookup(ctx context.Context, kind, ref string) (*Status, error) {
+	var (
+		s         Status
+		lastError sql.NullString
+		result    sql.NullString
+	)
+	err := q.db.QueryRowContext(
+		ctx,
+		`SELECT status, attempts, last_error, result FROM jobs WHERE kind = ? AND ref = ? ORDER BY id DESC LIMIT 1`,
+		kind, ref,
+	).Scan(&s.Status, &s.Attempts, &lastError, &result)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.LastError = lastError.String
+	if result.Valid {
+		s.Result = []byte(result.String)
+	}
+	return &s, nil
+}
+
+// Start requeues jobs interrupted by a previous shutdown and runs the worker pool until ctx is done.
+func (q *Queue) Start(ctx context.Context) error {
+	res, err := q.db.ExecContext(
+		ctx,
+		`UPDATE jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE status = ?`,
+		StatusPending, StatusRunning,
+	)
+	if err != nil {
+		return fmt.Errorf("requeue running jobs: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("jobs: requeued %d interrupted job(s)", n)
+	}
+
+	for i := 0; i < q.cfg.Workers; i++ {
+		go q.work(ctx)
+	}
+	return nil
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		// Drain every due job before going idle.
+		for {
+			job, err := q.claim(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("jobs: claim failed: %v", err)
+				}
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.run(ctx, *job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// claim atomically marks the oldest due pending job as running. Returns nil when there is none.
+func (q *Queue) claim(ctx context.Context) (*Job, error) {
+	var j Job
+	var payload string
+	err := q.db.QueryRowContext(ctx, `
+UPDATE jobs
+SET status = ?, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+WHERE id = (
+  SELECT id FROM jobs
+  WHERE status = ? AND run_at <= ?
+  ORDER BY run_at, id
+  LIMIT 1
+)
+RETURNING id, kind, ref, payload, attempts, max_attempts;
+`,
+		StatusRunning, StatusPending, time.Now().UnixMilli(),
+	).Scan(&j.ID, &j.Kind, &j.Ref, &payload, &j.Attempt, &j.MaxAttempts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.Payload = []byte(payload)
+	return &j, nil
+}
+
+func (q *Queue) run(ctx context.Context, job Job) {
+	q.mu.RLock()
+	h, ok := q.handlers[job.Kind]
+	onFail := q.onFail[job.Kind]
+	q.mu.RUnlock()
+
+	var (
+		result any
+		err    error
+	)
+	if !ok {
+		err = Permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	} else {
+		result, err = safeCall(ctx, h, job)
+	}
+
+	if err == nil {
+		if err := q.finish(ctx, job, result); err != nil {
+			log.Printf("jobs: mark job %d done failed: %v", job.ID, err)
+		}
+		return
+	}
+
+	var perm *permanentError
+	if errors.As(err, &perm) || job.Attempt >= job.MaxAttempts {
+		log.Printf("jobs: %s job %d failed for good after %d attempt(s): %v", job.Kind, job.ID, job.Attempt, err)
+		if err := q.setStatus(ctx, job.ID, StatusFailed, err.Error(), 0); err != nil {
+			log.Printf("jobs: mark job %d failed failed: %v", job.ID, err)
+		}
+		if onFail != nil {
+			onFail(job, err)
+		}
+		return
+	}
+
+	delay := q.backoff(job.Attempt)
+	log.Printf("jobs: %s job %d attempt %d/%d failed, retrying in %s: %v", job.Kind, job.ID, job.Attempt, job.MaxAttempts, delay, err)
+	if err := q.setStatus(ctx, job.ID, StatusPending, err.Error(), time.Now().Add(delay).UnixMilli()); err != nil {
+		log.Printf("jobs: reschedule job %d failed: %v", job.ID, err)
+	}
+}
+
+// safeCall turns a panicking handler into a failed attempt instead of a dead worker.
+func safeCall(ctx context.Context, h Handler, job Job) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+func (q *Queue) finish(ctx context.Context, job Job, result any) error {
+	var resultJSON sql.NullString
+	if result != nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resultJSON = sql.NullString{String: string(b), Valid: true}
+	}
+	_, err := q.db.ExecContext(
+		ctx,
+		`UPDATE jobs SET status = ?, result = ?, last_error = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		StatusDone, resultJSON, job.ID,
+	)
+	return err
+}
+
+// setStatus records a failed attempt; runAt is only applied when non-zero.
+func (q *Queue) setStatus(ctx context.Context, id int64, status, lastError string, runAt int64) error {
+	_, err := q.db.ExecContext(
+		ctx,
+		`UPDATE jobs
+SET status = ?, last_error = ?, run_at = CASE WHEN ? > 0 THEN ? ELSE run_at END, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?`,
+		status, lastError, runAt, runAt, id,
+	)
+	return err
+}
+
+// backoff is BaseBackoff * 2^(attempt-1), capped at MaxBackoff.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.cfg.BaseBackoff
+	for i := 1; i < attempt && d < q.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, q.cfg.MaxBackoff)
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying (e.g. a corrupt input file).
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
@@ -0,0 +1,149 @@
+package jobs_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"instagram-lite-backend/config"
+	"instagram-lite-backend/internal/jobs"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestQueue(t *testing.T) (*sql.DB, *jobs.Queue) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := config.Migrate(db, filepath.Join("..", "..", "migrations")); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	q := jobs.NewQueue(db, jobs.Config{
+		Workers:      2,
+		MaxAttempts:  3,
+		PollInterval: 10 * time.Millisecond,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+	})
+	return db, q
+}
+
+func startQueue(t *testing.T, q *jobs.Queue) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := q.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+}
+
+// waitStatus polls until the job of ref reaches want.
+func waitStatus(t *testing.T, q *jobs.Queue, kind, ref, want string) *jobs.Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		st, err := q.Lookup(context.Background(), kind, ref)
+		if err == nil && st.Status == want {
+			return st
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s/%s never reached %q", kind, ref, want)
+	return nil
+}
+
+func TestQueueRetriesUntilSuccess(t *testing.T) {
+	_, q := newTestQueue(t)
+	q.Register("flaky", func(ctx context.Context, job jobs.Job) (any, error) {
+		if job.Attempt < 3 {
+			return nil, errors.New("transient")
+		}
+		return map[string]string{"ok": "yes"}, nil
+	}, nil)
+	startQueue(t, q)
+
+	if _, err := q.Enqueue(context.Background(), "flaky", "a", nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	st := waitStatus(t, q, "flaky", "a", jobs.StatusDone)
+	if st.Attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", st.Attempts)
+	}
+	if string(st.Result) != `{"ok":"yes"}` {
+		t.Fatalf("result = %s", st.Result)
+	}
+}
+
+func TestQueuePermanentFailure(t *testing.T) {
+	_, q := newTestQueue(t)
+	failed := make(chan error, 1)
+	q.Register("bad", func(ctx context.Context, job jobs.Job) (any, error) {
+		return nil, jobs.Permanent(errors.New("corrupt input"))
+	}, func(job jobs.Job, err error) { failed <- err })
+	startQueue(t, q)
+
+	if _, err := q.Enqueue(context.Background(), "bad", "b", nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	st := waitStatus(t, q, "bad", "b", jobs.StatusFailed)
+	if st.Attempts != 1 {
+		t.Fatalf("attempts = %d, want 1 (no retries)", st.Attempts)
+	}
+	if st.LastError != "corrupt input" {
+		t.Fatalf("last error = %q", st.LastError)
+	}
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("failure hook not called")
+	}
+}
+
+func TestQueueGivesUpAfterMaxAttempts(t *testing.T) {
+	_, q := newTestQueue(t)
+	q.Register("down", func(ctx context.Context, job jobs.Job) (any, error) {
+		return nil, errors.New("storage unavailable")
+	}, nil)
+	startQueue(t, q)
+
+	if _, err := q.Enqueue(context.Background(), "down", "c", nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if st := waitStatus(t, q, "down", "c", jobs.StatusFailed); st.Attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", st.Attempts)
+	}
+}
+
+func TestQueueResumesInterruptedJobs(t *testing.T) {
+	db, q := newTestQueue(t)
+	// a job claimed by a process that died before finishing it
+	if _, err := db.Exec(
+		`INSERT INTO jobs (kind, ref, payload, status, attempts, max_attempts, run_at) VALUES ('resume', 'd', '{}', 'running', 1, 3, 0)`,
+	); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	q.Register("resume", func(ctx context.Context, job jobs.Job) (any, error) {
+		return nil, nil
+	}, nil)
+	startQueue(t, q)
+
+	if st := waitStatus(t, q, "resume", "d", jobs.StatusDone); st.Attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", st.Attempts)
+	}
+}
+
+func TestLookupUnknownJob(t *testing.T) {
+	_, q := newTestQueue(t)
+	if _, err := q.Lookup(context.Background(), "none", "x"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
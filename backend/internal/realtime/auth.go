@@ -0,0 +1,69 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// TokenVerifier resolves a session token to the id of its user. It returns ErrInvalidToken for tokens
+// that don't belong to anybody; other errors are reported to the client as a failed authentication.
+type TokenVerifier func(ctx context.Context, token string) (userID string, err error)
+
+// ErrInvalidToken is returned by a TokenVerifier for a bad or expired token.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+var (
+	errNoToken          = errors.New("auth needs a token")
+	errAlreadyAuthed    = errors.New("already authenticated as another user")
+	errAuthNotSupported = errors.New("authentication is not supported on this connection")
+	errAuthFailed       = errors.New("authentication failed")
+)
+
+// Authenticated is the payload of the "authenticated" reply to an auth message.
+type Authenticated struct {
+	UserID string `json:"user_id"`
+}
+
+// SetUser binds c to a user. It must be called before c is registered; afterwards the hub goroutine owns it.
+func (c *Client) SetUser(userID string) {
+	c.user = userID
+}
+
+// handle runs a client command and returns the encoded reply. Runs in the hub goroutine.
+func (c *Client) handle(cmd command) []byte {
+	if cmd.msg.Type != "auth" {
+		return c.apply(cmd.msg)
+	}
+	if cmd.err != nil {
+		return encodeReply(Message{Type: "error", Data: ErrorEvent{Error: cmd.err.Error()}})
+	}
+	if c.user != "" && c.user != cmd.user {
+		return encodeReply(Message{Type: "error", Data: ErrorEvent{Error: errAlreadyAuthed.Error()}})
+	}
+	c.user = cmd.user
+	return encodeReply(Message{Type: "authenticated", Data: Authenticated{UserID: c.user}})
+}
+
+// VerifyToken checks the token of an auth message with verify (nil: auth is not supported).
+// The returned error can be shown to the client.
+func VerifyToken(verify TokenVerifier, token string) (string, error) {
+	if verify == nil {
+		return "", errAuthNotSupported
+	}
+	if token == "" {
+		return "", errNoToken
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	userID, err := verify(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return "", ErrInvalidToken
+		}
+		log.Printf("ws auth failed: %v", err)
+		return "", errAuthFailed
+	}
+	return userID, nil
+}
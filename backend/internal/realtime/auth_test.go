@@ -0,0 +1,106 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// testVerifier accepts the tokens "alice" and "bob" for the users of the same name.
+func testVerifier(_ context.Context, token string) (string, error) {
+	if token == "alice" || token == "bob" {
+		return token, nil
+	}
+	return "", ErrInvalidToken
+}
+
+func TestAuthMessage(t *testing.T) {
+	h := NewHub(NewMemoryBroker())
+	conn := dial(t, h)
+
+	for _, tc := range []struct {
+		token string
+		want  string
+	}{
+		{token: "", want: errNoToken.Error()},
+		{token: "mallory", want: ErrInvalidToken.Error()},
+	} {
+		m := send(t, conn, ClientMessage{Type: "auth", Token: tc.token})
+		var e ErrorEvent
+		if err := json.Unmarshal(m.Data, &e); err != nil || m.Type != "error" || e.Error != tc.want {
+			t.Errorf("token %q: got %s %s, want error %q", tc.token, m.Type, m.Data, tc.want)
+		}
+	}
+
+	m := send(t, conn, ClientMessage{Type: "auth", Token: "alice"})
+	var a Authenticated
+	if err := json.Unmarshal(m.Data, &a); err != nil || m.Type != "authenticated" || a.UserID != "alice" {
+		t.Fatalf("got %s %s, want authenticated as alice", m.Type, m.Data)
+	}
+	// the same user again is fine, another one is not
+	if m := send(t, conn, ClientMessage{Type: "auth", Token: "alice"}); m.Type != "authenticated" {
+		t.Errorf("re-auth as alice: got %s", m.Type)
+	}
+	if m := send(t, conn, ClientMessage{Type: "auth", Token: "bob"}); m.Type != "error" {
+		t.Errorf("auth as bob: got %s, want error", m.Type)
+	}
+}
+
+func TestConnectedCarriesUser(t *testing.T) {
+	h := NewHub(NewMemoryBroker())
+	c := NewClient()
+	c.SetUser("alice")
+	h.Register(c)
+	defer h.Unregister(c)
+
+	f := <-c.Messages()
+	var m struct {
+		Type string    `json:"type"`
+		Data Connected `json:"data"`
+	}
+	if err := json.Unmarshal(f.Data, &m); err != nil || m.Type != "connected" || m.Data.UserID != "alice" {
+		t.Fatalf("got %s, want connected as alice", f.Data)
+	}
+}
+
+func TestUploadEventsOnlyReachTheUploader(t *testing.T) {
+	broker := NewMemoryBroker()
+	a := NewHub(broker)
+	b := NewHub(broker)
+	// alice on both instances, bob and an anonymous client on a
+	aliceA, aliceB, bobA := dial(t, a), dial(t, b), dial(t, a)
+	anon := dial(t, a)
+	for conn, token := range map[*websocket.Conn]string{aliceA: "alice", aliceB: "alice", bobA: "bob"} {
+		if m := send(t, conn, ClientMessage{Type: "auth", Token: token}); m.Type != "authenticated" {
+			t.Fatalf("auth as %s: got %s", token, m.Type)
+		}
+	}
+	start := next(t, connect(t, a, "")) // the "connected" event carries the latest seq
+
+	a.SendUploadReady("alice", UploadReady{UploadID: "up1"})
+	a.SendUploadFailed("alice", "up2", "cannot process")
+	a.SendUploadReady("", UploadReady{UploadID: "anonymous"}) // nobody to tell
+
+	for _, conn := range []*websocket.Conn{aliceA, aliceB} {
+		for _, want := range []string{"upload_ready", "upload_failed"} {
+			if m := next(t, conn); m.Type != want || m.Seq != 0 {
+				t.Fatalf("alice got %s #%d, want %s without seq", m.Type, m.Seq, want)
+			}
+		}
+	}
+	expectNothing(t, bobA)
+	expectNothing(t, anon)
+
+	// not sequenced, so not replayed to a resuming client either
+	var hello Connected
+	if err := json.Unmarshal(start.Data, &hello); err != nil {
+		t.Fatalf("decode connected: %v", err)
+	}
+	resumed := connect(t, a, Position{Node: hello.Node, Seq: hello.Seq}.EventID())
+	a.BroadcastPostDeleted("p")
+	if m := next(t, resumed); m.Type != "post_deleted" || m.Seq != hello.Seq+1 {
+		t.Fatalf("got %s #%d, want post_deleted #%d", m.Type, m.Seq, hello.Seq+1)
+	}
+}
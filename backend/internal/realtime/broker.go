@@ -0,0 +1,140 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Broker relays hub events between backend instances, so a post created on one reaches the sockets of all.
+// Every instance publishes the events of its own handlers and delivers the ones it receives from the others.
+type Broker interface {
+	// Publish sends ev to every subscribed instance, the publishing one included.
+	Publish(ctx context.Context, ev BrokerEvent) error
+	// Subscribe calls handle for each published event until ctx is done or the subscription breaks.
+	// It returns once the subscription is active; events are handled on another goroutine, in publish order.
+	Subscribe(ctx context.Context, handle func(BrokerEvent)) (done <-chan error, err error)
+}
+
+// BrokerEvent is a hub event on its way between instances.
+type BrokerEvent struct {
+	Origin string          `json:"origin"` // node id of the publishing hub, so it can skip its own events
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+	Tagged bool            `json:"tagged,omitempty"` // filtered by tag subscriptions, see event
+	Tags   []string        `json:"tags,omitempty"`
+	User   string          `json:"user,omitempty"` // only for this user's clients, see event
+}
+
+// MemoryBroker connects the hubs of one process. With a single hub, events have nowhere else to go:
+// this is the default for a single instance, and lets tests run several "instances" side by side.
+type MemoryBroker struct {
+	mu   sync.Mutex
+	subs map[*memorySub]struct{}
+}
+
+type memorySub struct {
+	events chan BrokerEvent
+	quit   chan struct{} // closed when the subscription ends, so publishers stop waiting on it
+	done   chan error
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subs: make(map[*memorySub]struct{})}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, ev BrokerEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		select {
+		case s.events <- ev:
+		case <-s.quit:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, handle func(BrokerEvent)) (<-chan error, error) {
+	s := &memorySub{events: make(chan BrokerEvent, 128), quit: make(chan struct{}), done: make(chan error, 1)}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		defer func() {
+			close(s.quit)
+			b.mu.Lock()
+			delete(b.subs, s)
+			b.mu.Unlock()
+			s.done <- ctx.Err()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-s.events:
+				handle(ev)
+			}
+		}
+	}()
+	return s.done, nil
+}
+
+// brokerRetry is the pause before resubscribing after the broker subscription failed.
+const brokerRetry = time.Second
+
+// relay queues a locally broadcast event for the other instances. Local clients already got it,
+// so a full queue (broker down or slow) drops it rather than blocking the caller.
+func (h *Hub) relay(ev event) {
+	data, err := json.Marshal(ev.msg.Data)
+	if err != nil {
+		log.Printf("ws marshal failed: %v", err)
+		return
+	}
+	select {
+	case h.outbox <- BrokerEvent{Origin: h.node, Type: ev.msg.Type, Data: data, Tagged: ev.tagged, Tags: ev.tags, User: ev.user}:
+	default:
+		log.Printf("realtime: broker queue full, %s not relayed to other instances", ev.msg.Type)
+	}
+}
+
+// publish sends queued events to the broker, one at a time to keep their order.
+func (h *Hub) publish() {
+	for ev := range h.outbox {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := h.broker.Publish(ctx, ev); err != nil {
+			log.Printf("realtime: publish %s failed: %v", ev.Type, err)
+		}
+		cancel()
+	}
+}
+
+// listen subscribes to the broker and keeps resubscribing when the subscription breaks.
+// The first attempt happens before NewHub returns, so events published from then on are received.
+func (h *Hub) listen() {
+	done, err := h.broker.Subscribe(context.Background(), h.receive)
+	go func() {
+		for {
+			if err == nil {
+				err = <-done
+			}
+			log.Printf("realtime: broker subscription failed: %v", err)
+			time.Sleep(brokerRetry)
+			done, err = h.broker.Subscribe(context.Background(), h.receive)
+		}
+	}()
+}
+
+// receive delivers an event of another instance to this hub's clients.
+// This hub's own events come back too; its clients already got them.
+func (h *Hub) receive(ev BrokerEvent) {
+	if ev.Origin == h.node {
+		return
+	}
+	h.broadcast <- event{msg: Message{Type: ev.Type, Data: ev.Data}, tagged: ev.Tagged, tags: ev.Tags, user: ev.User}
+}
@@ -0,0 +1,69 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryBrokerFanOut(t *testing.T) {
+	testFanOut(t, NewMemoryBroker())
+}
+
+func TestRedisBrokerFanOut(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	testFanOut(t, NewRedisBroker(client, "events"))
+}
+
+// testFanOut runs two hubs ("instances") on one broker: an event broadcast on either reaches
+// the clients of both, exactly once.
+func testFanOut(t *testing.T, broker Broker) {
+	a := NewHub(broker)
+	b := NewHub(broker)
+	onA := dial(t, a)
+	onB := dial(t, b)
+	if m := send(t, onB, ClientMessage{Type: "subscribe", Tags: []string{"cat"}}); m.Type != "subscribed" {
+		t.Fatalf("subscribe reply = %s", m.Type)
+	}
+
+	a.BroadcastPostCreated(PostItem{ID: "dog-post", Tags: []string{"dog"}})
+	a.BroadcastPostCreated(PostItem{ID: "cat-post", Tags: []string{"cats"}})
+	b.BroadcastPostDeleted("dog-post")
+
+	for _, want := range []string{"post_created", "post_created"} {
+		if m := next(t, onA); m.Type != want {
+			t.Fatalf("client on a got %s, want %s", m.Type, want)
+		}
+	}
+	if m := next(t, onA); m.Type != "post_deleted" {
+		t.Fatalf("client on a got %s, want the post_deleted of b", m.Type)
+	}
+
+	// tag subscriptions apply to relayed events too; b's own event is not delivered twice
+	want := []string{"post_created", "post_deleted"}
+	got := map[string]int{}
+	for range want {
+		got[next(t, onB).Type]++
+	}
+	for _, w := range want {
+		if got[w] != 1 {
+			t.Fatalf("client on b got %v, want %v once each", got, want)
+		}
+	}
+	expectNothing(t, onA)
+	expectNothing(t, onB)
+}
+
+func expectNothing(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var m received
+	if err := conn.ReadJSON(&m); err == nil {
+		t.Fatalf("unexpected %s event", m.Type)
+	}
+}
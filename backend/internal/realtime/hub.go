@@ -3,66 +3,179 @@ package realtime
 import (
 	"encoding/json"
 	"log"
-	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/oklog/ulid/v2"
 )
 
 
 type Message struct {
-	Type string      `json:"type"` // e.g. "post_created" "ping" "error"
+	Type string      `json:"type"` // e.g. "post_created" "post_updated" "post_liked" "post_deleted" "comment_created" "upload_ready" "upload_failed" "subscribed" "authenticated" "connected" "resync_required" "ping" "error"
+	Seq  uint64      `json:"seq,omitempty"` // sequence id of broadcast events, see replay.go
 	Data interface{} `json:"data"`
 }
 
 type PostItem struct {
-	ID        string   `json:"id"`
-	Title     string   `json:"title"`
-	ImageURL  string   `json:"image_url"`
-	Tags      []string `json:"tags"`
-	CreatedAt string   `json:"created_at"`
+	ID           string            `json:"id"`
+	Title        string            `json:"title"`
+	ImageURL     string            `json:"image_url"`
+	Images       map[string]string `json:"images"`
+	ImagesWebP   map[string]string `json:"images_webp"`
+	Width        *int              `json:"width"`
+	Height       *int              `json:"height"`
+	Tags         []string          `json:"tags"`
+	CreatedAt    string            `json:"created_at"`
+	UpdatedAt    *string           `json:"updated_at,omitempty"`
+	Author       *Author           `json:"author"`
+	LikeCount    int               `json:"like_count"`
+	CommentCount int               `json:"comment_count"`
 }
 
-// server-side representation of a connected WebSocket peer
+type Author struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// PostLiked is the payload of a "post_liked" event, sent whenever a post's like count changes.
+type PostLiked struct {
+	ID        string `json:"id"`
+	LikeCount int    `json:"like_count"`
+}
+
+// CommentItem mirrors handlers.CommentItem.
+type CommentItem struct {
+	ID        string  `json:"id"`
+	ParentID  *string `json:"parent_id"`
+	Body      string  `json:"body"`
+	Author    *Author `json:"author"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// CommentCreated is the payload of a "comment_created" event.
+type CommentCreated struct {
+	PostID       string      `json:"post_id"`
+	CommentCount int         `json:"comment_count"` // new total for the post, replies included
+	Comment      CommentItem `json:"comment"`
+}
+
+// PostDeleted is the payload of a "post_deleted" event.
+type PostDeleted struct {
+	ID string `json:"id"`
+}
+
+// UploadReady is the payload of an "upload_ready" event, sent when an upload's renditions are stored.
+type UploadReady struct {
+	UploadID   string            `json:"upload_id"`
+	ImageURL   string            `json:"image_url"`
+	Images     map[string]string `json:"images"`
+	ImagesWebP map[string]string `json:"images_webp"` // rendition size -> URL of its WebP encoding
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+}
+
+// UploadFailed is the payload of an "upload_failed" event.
+type UploadFailed struct {
+	UploadID string `json:"upload_id"`
+	Error    string `json:"error"`
+}
+
+// server-side representation of a connected peer, whatever the transport (websocket.go, or the SSE handler)
 type Client struct {
-	// underlying WebSocket connection for this client.
-	conn *websocket.Conn
 	//  buffered message queue.
-	//  Later, a writer goroutine would drain it and write it to ws connection serially to avoid concurrently writing issues(data race issues).
-	send chan []byte 
+	//  The transport drains it and writes the messages to its connection serially to avoid concurrently writing issues(data race issues).
+	//  The hub closes it when it removes the client; the transport then closes its connection.
+	send chan Frame
+	// tag queries the client subscribed to (see subscriptions.go); empty means everything.
+	// Only read and written by the hub goroutine once the client is registered.
+	tags map[string]struct{}
+	// id of the user the client authenticated as, "" for anonymous clients (see auth.go). Owned by the hub goroutine too.
+	user string
+}
+
+// Frame is one encoded message for a client.
+type Frame struct {
+	Seq  uint64 // sequence id of broadcast events (the latest one for "connected" and "resync_required"), 0 for other replies
+	Data []byte // the JSON encoded Message
 }
 
-// creates a new WebSocket client.
-func NewClient(conn *websocket.Conn) *Client {
+// creates a new client; register it with the hub and hand Messages to a transport.
+func NewClient() *Client {
 	return &Client{
-		conn: conn,
-		send: make(chan []byte, 128),
+		send: make(chan Frame, clientBuffer),
+		tags: make(map[string]struct{}),
 	}
 }
 
-// Hub is a pub/sub for WebSocket clients.
+// Messages is the client's message queue. It is closed when the hub drops the client.
+func (c *Client) Messages() <-chan Frame {
+	return c.send
+}
+
+// Hub is a pub/sub for realtime clients (websocket and SSE).
 type Hub struct {
-	register   chan *Client
+	register   chan registration
 	unregister chan *Client
-	broadcast  chan []byte
+	broadcast  chan event
+	commands   chan command
 	clients    map[*Client]struct{}
+	// last assigned sequence id and the recent events, for clients resuming with ?since= (see Position)
+	seq     uint64
+	history *history
+	// relays events to the hubs of other instances, see broker.go
+	broker Broker
+	node   string // this hub's id in BrokerEvent.Origin and Position.Node
+	outbox chan BrokerEvent
+}
+
+// event is one broadcast. Post events carry the post's tags for subscription filtering.
+// The hub goroutine assigns seq and encodes payload.
+// Events for a single user (user set) only go to that user's clients; they get no seq and are not
+// kept in the history, so nobody else can replay them.
+type event struct {
+	msg     Message
+	seq     uint64
+	payload []byte
+	tagged  bool
+	tags    []string
+	user    string
 }
 
-func NewHub() *Hub {
+// NewHub creates the hub and subscribes it to broker, which relays events between instances.
+func NewHub(broker Broker) *Hub {
 	h := &Hub{
-		register:   make(chan *Client),
+		register:   make(chan registration),
 		unregister: make(chan *Client),
 	  // Small buffer to absorb short bursts of events (e.g. rapid post creation)
    // so HTTP handlers are not blocked by websocket fan-out.
-		broadcast:  make(chan []byte, 128), 
+		broadcast:  make(chan event, 128), 
+		commands:   make(chan command),
 		clients:    make(map[*Client]struct{}),
+		seq:        initialSeq(),
+		history:    newHistory(historySize),
+		broker:     broker,
+		node:       ulid.Make().String(),
+		outbox:     make(chan BrokerEvent, 128),
 	}
 	go h.run() // global goroutinme
+	go h.publish()
+	h.listen()
 	return h
 }
 
-// Register adds a client to the hub.
+// Register adds a client to the hub. It is first sent a "connected" event carrying the current sequence id.
 func (h *Hub) Register(c *Client) {
-	h.register <- c
+	h.register <- registration{client: c}
+}
+
+// Resume adds a client that was connected before and has seen events up to since.
+// The events it missed are replayed, or it is sent "resync_required" if they are no longer buffered
+// or since is from another hub.
+func (h *Hub) Resume(c *Client, since Position) {
+	h.register <- registration{client: c, since: since, resume: true}
+}
+
+// Node is the id of this hub, the Node of the Positions it hands out.
+func (h *Hub) Node() string {
+	return h.node
 }
 
 // Unregister removes a client from the hub.
@@ -70,105 +183,132 @@ func (h *Hub) Unregister(c *Client) {
 	h.unregister <- c
 }
 
+
 // All mutations of client happen here.
 func (h *Hub) run() {
 	for {
 		select {
-		case c := <-h.register:
-			h.clients[c] = struct{}{}
+		case r := <-h.register:
+			h.clients[r.client] = struct{}{}
+			h.catchUp(r)
 
 		case c := <-h.unregister:
 			if _, ok := h.clients[c]; ok {
 				delete(h.clients, c)
 				close(c.send)
-				_ = c.conn.Close()
 			}
 
-		case msg := <-h.broadcast:
+		case cmd := <-h.commands:
+			if _, ok := h.clients[cmd.client]; ok {
+				h.deliver(cmd.client, Frame{Data: cmd.client.handle(cmd)})
+			}
+
+		case ev := <-h.broadcast:
+			if ev.user != "" {
+				h.sendToUser(ev)
+				continue
+			}
+			h.seq++
+			ev.seq = h.seq
+			ev.msg.Seq = h.seq
+			b, err := json.Marshal(ev.msg)
+			if err != nil {
+				log.Printf("ws marshal failed: %v", err)
+				continue
+			}
+			ev.payload = b
+			h.history.add(ev)
+
 			for c := range h.clients {
-				select {
-				case c.send <- msg:
-				default:
-					// if the Client’s send queue is full; drop it to avoid blocking the hub.
-					delete(h.clients, c)
-					close(c.send)
-					_ = c.conn.Close()
+				if c.wants(ev) {
+					h.deliver(c, Frame{Seq: ev.seq, Data: ev.payload})
 				}
 			}
 		}
 	}
 }
 
-// BroadcastPostCreated encodes post and broadcasts a "post_created" event.
-func (h *Hub) BroadcastPostCreated(post PostItem) {
-	env := Message{Type: "post_created", Data: post}
-	b, err := json.Marshal(env)
+// sendToUser delivers an event addressed to one user to the clients authenticated as that user.
+// Runs in the hub goroutine.
+func (h *Hub) sendToUser(ev event) {
+	b, err := json.Marshal(ev.msg)
 	if err != nil {
 		log.Printf("ws marshal failed: %v", err)
 		return
 	}
-	h.broadcast <- b
+	for c := range h.clients {
+		if c.user == ev.user {
+			h.deliver(c, Frame{Data: b})
+		}
+	}
 }
 
+// deliver queues f for c. Runs in the hub goroutine.
+func (h *Hub) deliver(c *Client, f Frame) {
+	select {
+	case c.send <- f:
+	default:
+		// if the Client’s send queue is full; drop it to avoid blocking the hub.
+		// Closing the queue makes the transport close the connection.
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
 
-// Read and write goroutines for a single WebSocket client connection.
-const (
-	writeWait  = 10 * time.Second // Maximum time to write to the ws connection.
-	pongWait   = 60 * time.Second // How long we wait for pong from the client(browser) before considering the connection dead.
-	pingPeriod = (pongWait * 9) / 10 // Ping interval; should be < pongWait.
-)
+// BroadcastPostCreated encodes post and broadcasts a "post_created" event
+// (to clients without subscriptions and those subscribed to one of its tags).
+func (h *Hub) BroadcastPostCreated(post PostItem) {
+	h.broadcastPost(Message{Type: "post_created", Data: post}, post.Tags)
+}
 
-// Write to ws connection and send ping to the client to check whether the connection is alive
-func (c *Client) writePump() {
-	// set up a ticker to send ping to the client
-	ticker := time.NewTicker(pingPeriod)
-	defer func() {
-		ticker.Stop()
-		_ = c.conn.Close()
-	}()
+// BroadcastPostUpdated broadcasts a "post_updated" event carrying the edited post, filtered like post_created.
+func (h *Hub) BroadcastPostUpdated(post PostItem) {
+	h.broadcastPost(Message{Type: "post_updated", Data: post}, post.Tags)
+}
 
-	for {
-		select {
-		case msg, ok := <-c.send:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait)) // Set a write deadline to prevent blocking.
-			if !ok {
-				// Hub already closed the channel(de-register or too slow), 
-				// so we need to send close Frame instead of c.conn.close() to indicate it's a normal close behavior.
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-				log.Printf("ws write failed: %v", err)
-				return
-			}
+// BroadcastPostLiked broadcasts a "post_liked" event with the post's new like count.
+func (h *Hub) BroadcastPostLiked(postID string, likeCount int) {
+	h.broadcastMessage(Message{Type: "post_liked", Data: PostLiked{ID: postID, LikeCount: likeCount}})
+}
 
-		case <-ticker.C:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
-		}
-	}
+// BroadcastCommentCreated broadcasts a "comment_created" event so open post views can append it.
+func (h *Hub) BroadcastCommentCreated(ev CommentCreated) {
+	h.broadcastMessage(Message{Type: "comment_created", Data: ev})
 }
 
-// pong to the server to check whether the connection is alivce
-func (c *Client) readPump(h *Hub) {
-	defer func() { h.Unregister(c) }()
+// BroadcastPostDeleted broadcasts a "post_deleted" event so open feeds can drop the card.
+func (h *Hub) BroadcastPostDeleted(postID string) {
+	h.broadcastMessage(Message{Type: "post_deleted", Data: PostDeleted{ID: postID}})
+}
 
-	c.conn.SetReadLimit(1024) // small limit as we don't accept real client payloads(in case someone sends big payload)
-	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait)) // Close connection if we don't receive pong in time.
-	c.conn.SetPongHandler(func(string) error {
-		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait)) // Extend deadline on every pong.
-		return nil
-	})
+// SendUploadReady sends an "upload_ready" event to the uploader's clients once background processing
+// of an upload finished. userID is the uploader's public id; anonymous uploaders ("") have to poll.
+func (h *Hub) SendUploadReady(userID string, ev UploadReady) {
+	h.sendMessage(userID, Message{Type: "upload_ready", Data: ev})
+}
 
-	for {
-		if _, _, err := c.conn.ReadMessage(); err != nil {
-			return
-		}
+// SendUploadFailed sends an "upload_failed" event to the uploader's clients, like SendUploadReady.
+func (h *Hub) SendUploadFailed(userID, uploadID, reason string) {
+	h.sendMessage(userID, Message{Type: "upload_failed", Data: UploadFailed{UploadID: uploadID, Error: reason}})
+}
+
+func (h *Hub) broadcastMessage(env Message) {
+	h.post(event{msg: env})
+}
+
+func (h *Hub) broadcastPost(env Message, tags []string) {
+	h.post(event{msg: env, tagged: true, tags: tags})
+}
+
+func (h *Hub) sendMessage(userID string, env Message) {
+	if userID == "" {
+		return
 	}
+	h.post(event{msg: env, user: userID})
 }
 
-// Exported wrapper for writePump and readPump
-func (c *Client) WritePump() { c.writePump() }
-func (c *Client) ReadPump(h *Hub) { c.readPump(h) }
\ No newline at end of file
+// post hands ev to the hub goroutine and to the other instances.
+func (h *Hub) post(ev event) {
+	h.broadcast <- ev
+	h.relay(ev)
+}
@@ -0,0 +1,187 @@
+package realtime
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNormalizeTagQuery(t *testing.T) {
+	for in, want := range map[string]string{
+		"cat":    "cat",
+		" #Cat ": "cat",
+		"##cats": "cats",
+		"#":      "",
+		"  ":     "",
+		"c#at":   "c#at",
+	} {
+		if got := NormalizeTagQuery(in); got != want {
+			t.Errorf("NormalizeTagQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMatchesTags(t *testing.T) {
+	queries := map[string]struct{}{"cat": {}}
+	if !matchesTags(queries, []string{"sunset", "cats"}) {
+		t.Error("cat should match cats")
+	}
+	if matchesTags(queries, []string{"dog"}) {
+		t.Error("cat should not match dog")
+	}
+	if matchesTags(queries, nil) {
+		t.Error("cat should not match an untagged post")
+	}
+}
+
+// dial connects a new websocket client to a test server serving h and reads its "connected" event.
+func dial(t *testing.T, h *Hub) *websocket.Conn {
+	t.Helper()
+	conn := connect(t, h, "")
+	if m := next(t, conn); m.Type != "connected" {
+		t.Fatalf("first event = %s, want connected", m.Type)
+	}
+	return conn
+}
+
+// connect connects a websocket client to a test server serving h, resuming after since
+// (a Position.EventID) if it isn't empty.
+func connect(t *testing.T, h *Hub, since string) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := NewClient()
+		if s := r.URL.Query().Get("since"); s != "" {
+			pos, _ := ParseEventID(s)
+			h.Resume(c, pos)
+		} else {
+			h.Register(c)
+		}
+		wc := NewWSConn(conn, c, testVerifier)
+		go wc.WritePump()
+		go wc.ReadPump(h)
+	}))
+	t.Cleanup(srv.Close)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	if since != "" {
+		url += "?since=" + neturl.QueryEscape(since)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+type received struct {
+	Type string          `json:"type"`
+	Seq  uint64          `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+func send(t *testing.T, conn *websocket.Conn, msg ClientMessage) received {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return next(t, conn)
+}
+
+func next(t *testing.T, conn *websocket.Conn) received {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var m received
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return m
+}
+
+func TestSubscriptionsFilterPostEvents(t *testing.T) {
+	h := NewHub(NewMemoryBroker())
+	all := dial(t, h)
+	cats := dial(t, h)
+
+	// the replies also tell us both clients are registered
+	if m := send(t, all, ClientMessage{Type: "unsubscribe"}); m.Type != "subscribed" || string(m.Data) != `{"tags":[]}` {
+		t.Fatalf("unsubscribe reply = %s %s", m.Type, m.Data)
+	}
+	if m := send(t, cats, ClientMessage{Type: "subscribe", Tags: []string{"#Cat", " "}}); m.Type != "subscribed" || string(m.Data) != `{"tags":["cat"]}` {
+		t.Fatalf("subscribe reply = %s %s", m.Type, m.Data)
+	}
+
+	h.BroadcastPostCreated(PostItem{ID: "dog-post", Tags: []string{"dog"}})
+	h.BroadcastPostCreated(PostItem{ID: "cat-post", Tags: []string{"cats", "sunset"}})
+	h.BroadcastPostDeleted("dog-post")
+
+	for _, want := range []string{"post_created", "post_created", "post_deleted"} {
+		if m := next(t, all); m.Type != want {
+			t.Fatalf("unsubscribed client got %s, want %s", m.Type, want)
+		}
+	}
+
+	m := next(t, cats)
+	var post PostItem
+	if err := json.Unmarshal(m.Data, &post); err != nil || m.Type != "post_created" || post.ID != "cat-post" {
+		t.Fatalf("subscribed client got %s %s, want the cat post", m.Type, m.Data)
+	}
+	// non-post events are not filtered
+	if m := next(t, cats); m.Type != "post_deleted" {
+		t.Fatalf("subscribed client got %s, want post_deleted", m.Type)
+	}
+
+	// after unsubscribing everything, the client gets every post again
+	if m := send(t, cats, ClientMessage{Type: "unsubscribe", Tags: []string{"cat"}}); string(m.Data) != `{"tags":[]}` {
+		t.Fatalf("unsubscribe reply = %s", m.Data)
+	}
+	h.BroadcastPostCreated(PostItem{ID: "dog-post-2", Tags: []string{"dog"}})
+	if m := next(t, cats); m.Type != "post_created" {
+		t.Fatalf("got %s, want post_created", m.Type)
+	}
+}
+
+func TestInvalidClientMessages(t *testing.T) {
+	h := NewHub(NewMemoryBroker())
+	conn := dial(t, h)
+
+	for _, msg := range []ClientMessage{
+		{Type: "subscribe"},
+		{Type: "subscribe", Tags: []string{"#"}},
+		{Type: "shout", Tags: []string{"cat"}},
+	} {
+		if m := send(t, conn, msg); m.Type != "error" {
+			t.Errorf("%+v: got %s, want error", msg, m.Type)
+		}
+	}
+
+	tags := make([]string, maxSubscribedTags+1)
+	for i := range tags {
+		tags[i] = strings.Repeat("a", i+1)
+	}
+	if m := send(t, conn, ClientMessage{Type: "subscribe", Tags: tags}); m.Type != "error" {
+		t.Errorf("too many tags: got %s, want error", m.Type)
+	}
+	// the rejected subscribe changed nothing
+	if m := send(t, conn, ClientMessage{Type: "unsubscribe", Tags: []string{"x"}}); string(m.Data) != `{"tags":[]}` {
+		t.Errorf("tags after rejected subscribe = %s", m.Data)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if m := next(t, conn); m.Type != "error" {
+		t.Errorf("garbage: got %s, want error", m.Type)
+	}
+}
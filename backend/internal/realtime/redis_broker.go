@@ -0,0 +1,66 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var errSubscriptionClosed = errors.New("redis subscription closed")
+
+// RedisBroker relays events over a Redis pub/sub channel shared by every instance.
+// Pub/sub is fire-and-forget: an instance that is disconnected from Redis misses the events published meanwhile
+// (go-redis resubscribes on its own), its clients don't learn about them.
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisBroker(client *redis.Client, channel string) *RedisBroker {
+	return &RedisBroker{client: client, channel: channel}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, ev BrokerEvent) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, payload).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, handle func(BrokerEvent)) (<-chan error, error) {
+	ps := b.client.Subscribe(ctx, b.channel)
+	// wait for the subscription confirmation, so nothing published after Subscribe returns is missed
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer ps.Close()
+		messages := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				done <- ctx.Err()
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					done <- errSubscriptionClosed
+					return
+				}
+				var ev BrokerEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+					log.Printf("realtime: bad broker message: %v", err)
+					continue
+				}
+				handle(ev)
+			}
+		}
+	}()
+	return done, nil
+}
@@ -0,0 +1,146 @@
+package realtime
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// historySize is how many recent events the hub keeps for clients resuming with ?since=.
+	// A socket that was down for longer gets "resync_required" and refetches instead.
+	historySize = 256
+	// clientBuffer is a client's send queue; it holds a full replay plus some live events.
+	clientBuffer = 2 * historySize
+)
+
+// Connected is the payload of the "connected" event a new client gets first:
+// the sequence id of the latest event and the hub that numbered it, to pass as ?since= and ?node=
+// when reconnecting, and the user the connection was authenticated as, if any.
+type Connected struct {
+	Seq    uint64 `json:"seq"`
+	Node   string `json:"node"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// ResyncRequired is the payload of a "resync_required" event: the client missed events that are
+// no longer buffered (or were numbered by another instance), so it should refetch its data and continue from Seq.
+type ResyncRequired struct {
+	Seq  uint64 `json:"seq"`
+	Node string `json:"node"`
+}
+
+// Position is where a client's event stream stopped: the last sequence id it saw and the hub that assigned it.
+// Every instance numbers the events it delivers itself, so a sequence id only means something to that hub;
+// a client resuming on another instance (say, behind a load balancer) is told to resync.
+// Without a Node (?since= alone, or a bare SSE id) the sequence id is taken as one of the resuming hub's.
+type Position struct {
+	Node string
+	Seq  uint64
+}
+
+var errInvalidEventID = errors.New("invalid event id")
+
+// EventID encodes p as an SSE event id: "<node>:<seq>".
+func (p Position) EventID() string {
+	return p.Node + ":" + strconv.FormatUint(p.Seq, 10)
+}
+
+// ParseEventID reverses EventID. A bare sequence id (from before ids carried the node) parses
+// with an empty Node.
+func ParseEventID(id string) (Position, error) {
+	var p Position
+	seq := id
+	if i := strings.LastIndexByte(id, ':'); i >= 0 {
+		p.Node, seq = id[:i], id[i+1:]
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return Position{}, errInvalidEventID
+	}
+	p.Seq = n
+	return p, nil
+}
+
+// initialSeq seeds the sequence ids with the start time in milliseconds. Ids then keep increasing
+// across restarts (unless the previous process averaged over 1000 events per second), so a client
+// resuming with an id of a previous process is told to resync instead of silently missing events.
+func initialSeq() uint64 {
+	return uint64(time.Now().UnixMilli())
+}
+
+type registration struct {
+	client *Client
+	since  Position
+	resume bool
+}
+
+// catchUp sends a newly registered client "connected", or on resume the events after since
+// (filtered by the subscriptions it was created with) or "resync_required". Runs in the hub goroutine.
+func (h *Hub) catchUp(r registration) {
+	if !r.resume {
+		h.deliver(r.client, Frame{Seq: h.seq, Data: encodeReply(Message{Type: "connected", Data: Connected{Seq: h.seq, Node: h.node, UserID: r.client.user}})})
+		return
+	}
+	var (
+		missed []event
+		ok     bool
+	)
+	// no node: replay if the id is in this hub's range; one of another instance's most likely isn't
+	if r.since.Node == h.node || r.since.Node == "" {
+		missed, ok = h.history.since(r.since.Seq, h.seq)
+	}
+	if !ok {
+		h.deliver(r.client, Frame{Seq: h.seq, Data: encodeReply(Message{Type: "resync_required", Data: ResyncRequired{Seq: h.seq, Node: h.node}})})
+		return
+	}
+	for _, ev := range missed {
+		if _, ok := h.clients[r.client]; !ok {
+			return // dropped by deliver
+		}
+		if r.client.wants(ev) {
+			h.deliver(r.client, Frame{Seq: ev.seq, Data: ev.payload})
+		}
+	}
+}
+
+// history is a ring buffer of the latest broadcast events, oldest first.
+type history struct {
+	events []event
+	start  int // index of the oldest event once the buffer is full
+}
+
+func newHistory(size int) *history {
+	return &history{events: make([]event, 0, size)}
+}
+
+func (hs *history) add(ev event) {
+	if len(hs.events) < cap(hs.events) {
+		hs.events = append(hs.events, ev)
+		return
+	}
+	hs.events[hs.start] = ev
+	hs.start = (hs.start + 1) % len(hs.events)
+}
+
+// since returns the buffered events with a sequence id above seq, given the latest id.
+// ok is false if seq is unknown: events after it were already evicted, or it is from the future
+// (e.g. handed out by a previous process).
+func (hs *history) since(seq, latest uint64) (missed []event, ok bool) {
+	if seq > latest {
+		return nil, false
+	}
+	if seq == latest {
+		return nil, true
+	}
+	if len(hs.events) == 0 || hs.events[hs.start].seq > seq+1 {
+		return nil, false
+	}
+	for i := range hs.events {
+		if ev := hs.events[(hs.start+i)%len(hs.events)]; ev.seq > seq {
+			missed = append(missed, ev)
+		}
+	}
+	return missed, true
+}
@@ -0,0 +1,144 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestHistorySince(t *testing.T) {
+	hs := newHistory(4)
+	if _, ok := hs.since(10, 10); !ok {
+		t.Error("nothing happened since the latest id: want ok")
+	}
+	if _, ok := hs.since(9, 10); ok {
+		t.Error("empty history, missed an event: want resync")
+	}
+
+	for seq := uint64(11); seq <= 16; seq++ {
+		hs.add(event{seq: seq})
+	}
+	// 13..16 are buffered
+	for _, tc := range []struct {
+		since uint64
+		want  []uint64
+		ok    bool
+	}{
+		{since: 16, want: nil, ok: true},
+		{since: 14, want: []uint64{15, 16}, ok: true},
+		{since: 12, want: []uint64{13, 14, 15, 16}, ok: true},
+		{since: 11, ok: false}, // 12 was evicted
+		{since: 17, ok: false}, // from the future
+	} {
+		missed, ok := hs.since(tc.since, 16)
+		if ok != tc.ok {
+			t.Errorf("since(%d): ok = %v, want %v", tc.since, ok, tc.ok)
+			continue
+		}
+		var got []uint64
+		for _, ev := range missed {
+			got = append(got, ev.seq)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("since(%d) = %v, want %v", tc.since, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("since(%d) = %v, want %v", tc.since, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestResumeReplaysMissedEvents(t *testing.T) {
+	h := NewHub(NewMemoryBroker())
+	live := connect(t, h, "")
+	m := next(t, live)
+	var hello Connected
+	if err := json.Unmarshal(m.Data, &hello); err != nil || m.Type != "connected" || hello.Seq == 0 || hello.Node != h.Node() {
+		t.Fatalf("got %s %s, want connected with a sequence id", m.Type, m.Data)
+	}
+	start := hello.Seq
+
+	h.BroadcastPostCreated(PostItem{ID: "a"})
+	h.BroadcastPostLiked("a", 1)
+	h.BroadcastPostDeleted("a")
+	// once the live client saw them, the hub has buffered them
+	for i := uint64(1); i <= 3; i++ {
+		if m := next(t, live); m.Seq != start+i {
+			t.Fatalf("event %d has seq %d, want %d", i, m.Seq, start+i)
+		}
+	}
+
+	resumed := connect(t, h, Position{Node: hello.Node, Seq: start + 1}.EventID())
+	for _, want := range []string{"post_liked", "post_deleted"} {
+		if m := next(t, resumed); m.Type != want {
+			t.Fatalf("replayed %s, want %s", m.Type, want)
+		}
+	}
+	// and then it gets live events
+	h.BroadcastPostLiked("b", 2)
+	if m := next(t, resumed); m.Type != "post_liked" || m.Seq != start+4 {
+		t.Fatalf("got %s #%d, want post_liked #%d", m.Type, m.Seq, start+4)
+	}
+
+	// without a node the id is taken as this hub's
+	bare := connect(t, h, strconv.FormatUint(start+3, 10))
+	if m := next(t, bare); m.Type != "post_liked" || m.Seq != start+4 {
+		t.Fatalf("since without node: replayed %s #%d, want post_liked #%d", m.Type, m.Seq, start+4)
+	}
+
+	for _, since := range []string{
+		Position{Node: hello.Node, Seq: start - 1000}.EventID(),
+		Position{Node: hello.Node, Seq: start + 100}.EventID(),
+		strconv.FormatUint(start-1000, 10),
+		// sequence ids of another instance mean nothing here, even when in range
+		Position{Node: "other-node", Seq: start + 1}.EventID(),
+	} {
+		stale := connect(t, h, since)
+		m := next(t, stale)
+		var resync ResyncRequired
+		if err := json.Unmarshal(m.Data, &resync); err != nil || m.Type != "resync_required" || resync.Seq != start+4 || resync.Node != h.Node() {
+			t.Errorf("since=%s: got %s %s, want resync_required at %s:%d", since, m.Type, m.Data, h.Node(), start+4)
+		}
+	}
+}
+
+func TestEventIDRoundTrip(t *testing.T) {
+	for _, p := range []Position{{Node: "01JH8ZK9Q6R6YB8Z5Y0S8R4WQ2", Seq: 1760600000123}, {Node: "a:b", Seq: 0}} {
+		got, err := ParseEventID(p.EventID())
+		if err != nil || got != p {
+			t.Errorf("ParseEventID(%q) = %+v, %v", p.EventID(), got, err)
+		}
+	}
+	if got, err := ParseEventID("42"); err != nil || got != (Position{Seq: 42}) {
+		t.Errorf("bare sequence id: %+v, %v", got, err)
+	}
+	for _, id := range []string{"", "abc", "node:", "node:-1", "node:x"} {
+		if _, err := ParseEventID(id); err == nil {
+			t.Errorf("ParseEventID(%q) succeeded", id)
+		}
+	}
+}
+
+func TestResumeOnAnotherInstanceResyncs(t *testing.T) {
+	broker := NewMemoryBroker()
+	a, b := NewHub(broker), NewHub(broker)
+	onA := connect(t, a, "")
+	var hello Connected
+	if err := json.Unmarshal(next(t, onA).Data, &hello); err != nil {
+		t.Fatalf("decode connected: %v", err)
+	}
+	a.BroadcastPostDeleted("p")
+	seen := next(t, onA)
+
+	// b numbers the relayed event itself, so a's sequence id can't be resumed there
+	onB := connect(t, b, Position{Node: hello.Node, Seq: seen.Seq}.EventID())
+	m := next(t, onB)
+	var resync ResyncRequired
+	if err := json.Unmarshal(m.Data, &resync); err != nil || m.Type != "resync_required" || resync.Node != b.Node() {
+		t.Fatalf("got %s %s, want resync_required from %s", m.Type, m.Data, b.Node())
+	}
+}
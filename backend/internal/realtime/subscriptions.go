@@ -0,0 +1,142 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// maxSubscribedTags caps the tag queries one client can subscribe to.
+const maxSubscribedTags = 20
+
+// ClientMessage is what clients may send over the socket:
+//
+//	{"type": "subscribe", "tags": ["cat", "#dog"]}
+//	{"type": "unsubscribe", "tags": ["cat"]}   // no tags: unsubscribe from everything
+//	{"type": "auth", "token": "<session token>"} // see auth.go
+//
+// A client with no subscriptions receives every event. Once subscribed, it only receives
+// post_created / post_updated events of posts with a matching tag; other events are not filtered.
+type ClientMessage struct {
+	Type  string   `json:"type"`
+	Tags  []string `json:"tags"`
+	Token string   `json:"token,omitempty"`
+}
+
+// Subscribed is the payload of a "subscribed" reply: the client's tag queries after the change.
+type Subscribed struct {
+	Tags []string `json:"tags"`
+}
+
+// ErrorEvent is the payload of an "error" reply to an invalid client message.
+type ErrorEvent struct {
+	Error string `json:"error"`
+}
+
+// NormalizeTagQuery prepares a tag search term: trimmed, lower case, without leading '#'.
+// ListPosts' ?tag= uses the same rules, so a subscription matches what the search lists.
+func NormalizeTagQuery(q string) string {
+	return strings.TrimLeft(strings.ToLower(strings.TrimSpace(q)), "#")
+}
+
+// matchesTags reports whether any of the post's tags contains any of the queries (fuzzy, like ListPosts' ?tag=).
+func matchesTags(queries map[string]struct{}, postTags []string) bool {
+	for _, t := range postTags {
+		for q := range queries {
+			if strings.Contains(t, q) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// command is a parsed client message, handed from the client's read goroutine to the hub.
+type command struct {
+	client *Client
+	msg    ClientMessage
+	// outcome of the token check of an auth message, done by the read goroutine
+	user string
+	err  error
+}
+
+// apply changes c's subscriptions as requested by msg and returns the encoded reply. Runs in the hub goroutine.
+func (c *Client) apply(msg ClientMessage) []byte {
+	var queries []string
+	for _, raw := range msg.Tags {
+		if q := NormalizeTagQuery(raw); q != "" {
+			queries = append(queries, q)
+		}
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		if err := c.subscribe(queries); err != nil {
+			return encodeReply(Message{Type: "error", Data: ErrorEvent{Error: err.Error()}})
+		}
+	case "unsubscribe":
+		if len(msg.Tags) == 0 {
+			clear(c.tags)
+		}
+		for _, q := range queries {
+			delete(c.tags, q)
+		}
+	default:
+		return encodeReply(Message{Type: "error", Data: ErrorEvent{Error: "unknown message type"}})
+	}
+
+	current := make([]string, 0, len(c.tags))
+	for q := range c.tags {
+		current = append(current, q)
+	}
+	sort.Strings(current)
+	return encodeReply(Message{Type: "subscribed", Data: Subscribed{Tags: current}})
+}
+
+var (
+	errNoTags      = errors.New("subscribe needs at least one tag")
+	errTooManyTags = errors.New("too many subscribed tags (max 20)")
+)
+
+// Subscribe subscribes c to the given tag queries. It is for transports without inbound messages (SSE)
+// and must be called before c is registered; afterwards the hub goroutine owns the subscriptions.
+func (c *Client) Subscribe(tags []string) error {
+	var queries []string
+	for _, raw := range tags {
+		if q := NormalizeTagQuery(raw); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	return c.subscribe(queries)
+}
+
+// subscribe adds normalized queries to c's subscriptions, all or nothing.
+func (c *Client) subscribe(queries []string) error {
+	if len(queries) == 0 {
+		return errNoTags
+	}
+	added := 0
+	for _, q := range queries {
+		if _, ok := c.tags[q]; !ok {
+			added++
+		}
+	}
+	if len(c.tags)+added > maxSubscribedTags {
+		return errTooManyTags
+	}
+	for _, q := range queries {
+		c.tags[q] = struct{}{}
+	}
+	return nil
+}
+
+// wants reports whether ev passes c's subscriptions: subscribed clients only get posts with a matching tag.
+func (c *Client) wants(ev event) bool {
+	return !ev.tagged || len(c.tags) == 0 || matchesTags(c.tags, ev.tags)
+}
+
+func encodeReply(m Message) []byte {
+	b, _ := json.Marshal(m) // only plain structs, can't fail
+	return b
+}
@@ -0,0 +1,95 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Read and write goroutines for a single WebSocket client connection.
+const (
+	writeWait  = 10 * time.Second    // Maximum time to write to the ws connection.
+	pongWait   = 60 * time.Second    // How long we wait for pong from the client(browser) before considering the connection dead.
+	pingPeriod = (pongWait * 9) / 10 // Ping interval; should be < pongWait.
+)
+
+// WSConn carries a Client over a websocket connection.
+type WSConn struct {
+	// underlying WebSocket connection for this client.
+	conn   *websocket.Conn
+	client *Client
+	verify TokenVerifier // checks the token of auth messages; nil if the connection can't authenticate
+}
+
+func NewWSConn(conn *websocket.Conn, client *Client, verify TokenVerifier) *WSConn {
+	return &WSConn{conn: conn, client: client, verify: verify}
+}
+
+// Write to ws connection and send ping to the client to check whether the connection is alive
+func (c *WSConn) writePump() {
+	// set up a ticker to send ping to the client
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.client.Messages():
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait)) // Set a write deadline to prevent blocking.
+			if !ok {
+				// Hub already closed the channel(de-register or too slow),
+				// so we need to send close Frame instead of c.conn.close() to indicate it's a normal close behavior.
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg.Data); err != nil {
+				log.Printf("ws write failed: %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// pong to the server to check whether the connection is alivce
+func (c *WSConn) readPump(h *Hub) {
+	defer func() { h.Unregister(c.client) }()
+
+	c.conn.SetReadLimit(4096)                            // small limit as clients only send subscribe/unsubscribe/auth messages(in case someone sends big payload)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait)) // Close connection if we don't receive pong in time.
+	c.conn.SetPongHandler(func(string) error {
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait)) // Extend deadline on every pong.
+		return nil
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		// subscriptions and the user are changed by the hub goroutine, which owns the client
+		var msg ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			msg = ClientMessage{Type: "invalid"}
+		}
+		cmd := command{client: c.client, msg: msg}
+		if msg.Type == "auth" {
+			// the token check may hit the database, so it happens here rather than in the hub goroutine
+			cmd.user, cmd.err = VerifyToken(c.verify, msg.Token)
+		}
+		h.commands <- cmd
+	}
+}
+
+// Exported wrapper for writePump and readPump
+func (c *WSConn) WritePump()      { c.writePump() }
+func (c *WSConn) ReadPump(h *Hub) { c.readPump(h) }
@@ -3,7 +3,10 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -12,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// SpacesUploader stores objects in DigitalOcean Spaces (or any S3-compatible bucket).
 type SpacesUploader struct {
 	s3            *s3.Client
 	bucket        string
@@ -50,17 +54,109 @@ func NewSpacesUploader(ctx context.Context, cfg SpacesConfig) (*SpacesUploader,
 	}, nil
 }
 
-func (u *SpacesUploader) PutJPEG(ctx context.Context, key string, body []byte) (string, error) {
+func (u *SpacesUploader) Put(ctx context.Context, key string, body []byte, contentType string) error {
 	_, err := u.s3.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:       aws.String(u.bucket),
 		Key:          aws.String(key),
 		Body:         bytes.NewReader(body),
-		ContentType:  aws.String("image/jpeg"),
+		ContentType:  aws.String(contentType),
 		CacheControl: aws.String("public, max-age=31536000, immutable"), // one year caching 
 		ACL:          types.ObjectCannedACLPublicRead,
 	})
+	return err
+}
+
+func (u *SpacesUploader) Get(ctx context.Context, key string) ([]byte, ObjectInfo, error) {
+	out, err := u.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, mapS3Error(err)
+	}
+	defer out.Body.Close()
+
+	body, err := io.ReadAll(out.Body)
 	if err != nil {
-		return "", err
+		return nil, ObjectInfo{}, err
+	}
+	info := ObjectInfo{
+		Key:         key,
+		Size:        int64(len(body)),
+		ContentType: aws.ToString(out.ContentType),
+	}
+	if out.LastModified != nil {
+		info.LastModified = *out.LastModified
 	}
-	return u.publicBaseURL + "/" + key, nil
-}
\ No newline at end of file
+	return body, info, nil
+}
+
+func (u *SpacesUploader) Delete(ctx context.Context, key string) error {
+	// S3 DeleteObject succeeds for missing keys, so deleting twice is harmless.
+	_, err := u.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	})
+	return mapS3Error(err)
+}
+
+func (u *SpacesUploader) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	out, err := u.s3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, mapS3Error(err)
+	}
+	info := ObjectInfo{
+		Key:         key,
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: aws.ToString(out.ContentType),
+	}
+	if out.LastModified != nil {
+		info.LastModified = *out.LastModified
+	}
+	return info, nil
+}
+
+func (u *SpacesUploader) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var out []ObjectInfo
+	pages := s3.NewListObjectsV2Paginator(u.s3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(u.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			info := ObjectInfo{
+				Key:  aws.ToString(obj.Key),
+				Size: aws.ToInt64(obj.Size),
+			}
+			if obj.LastModified != nil {
+				info.LastModified = *obj.LastModified
+			}
+			out = append(out, info)
+		}
+	}
+	return out, nil
+}
+
+func (u *SpacesUploader) PublicURL(key string) string {
+	return strings.TrimRight(u.publicBaseURL, "/") + "/" + key
+}
+
+// HeadObject reports a missing key as NotFound (no body), GetObject as NoSuchKey.
+func mapS3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	var noKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noKey) || errors.As(err, &notFound) {
+		return ErrNotFound
+	}
+	return err
+}
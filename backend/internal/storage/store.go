@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested object does not exist in the store.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object without fetching its body.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ObjectStore is the storage abstraction used by the handlers.
+// Keys are slash separated paths, e.g. "uploads/<ulid>.jpg".
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns every object whose key starts with prefix, e.g. "uploads/<id>/".
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// PublicURL returns the URL clients use to fetch the object.
+	PublicURL(key string) string
+}
+
+// PutJPEG stores a JPEG and returns its public URL.
+func PutJPEG(ctx context.Context, s ObjectStore, key string, body []byte) (string, error) {
+	if err := s.Put(ctx, key, body, "image/jpeg"); err != nil {
+		return "", err
+	}
+	return s.PublicURL(key), nil
+}
+
+// KeyFromURL reverses PublicURL. ok is false when url does not point into s
+// (e.g. seeded posts referencing third-party images).
+func KeyFromURL(s ObjectStore, url string) (key string, ok bool) {
+	key, ok = strings.CutPrefix(url, s.PublicURL(""))
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
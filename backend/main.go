@@ -2,6 +2,7 @@ package main
 
 import (
 	"instagram-lite-backend/config"
+	"instagram-lite-backend/internal/handlers"
 	"instagram-lite-backend/routes"
 	"log"
 
@@ -19,12 +20,31 @@ func main() {
 	// Initialize storage
 	config.InitStorage()
 
-	// Create Gin router
-	router := gin.Default()
+	// Initialize session token signing
+	config.InitAuth()
+
+	// Initialize image rendition sizes
+	config.InitImages()
+
+	// Initialize the background job queue
+	config.InitJobs()
+
+	// Initialize orphaned upload collection
+	config.InitUploadSweeper()
+
+	// Initialize the realtime broker (fan-out between instances)
+	config.InitRealtime()
+
+	// Create Gin router: gin.Default's middleware, with session tokens kept out of the access log
+	router := gin.New()
+	router.Use(handlers.AccessLogger(), gin.Recovery())
 
 	// Setup routes
 	routes.SetupRoutes(router)
 
+	// Start background workers (job handlers are registered by SetupRoutes)
+	config.StartJobs()
+
 	// Start server
 	log.Println("Server starting on :8080")
 	if err := router.Run(":8080"); err != nil {
@@ -0,0 +1,2 @@
+-- updated_at: set when a post's title or tags are edited (NULL = never edited)
+ALTER TABLE posts ADD COLUMN updated_at TIMESTAMP;
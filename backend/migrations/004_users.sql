@@ -0,0 +1,18 @@
+PRAGMA foreign_keys = ON;
+
+-- Users
+-- id: internal primary key
+-- user_id: public id
+CREATE TABLE IF NOT EXISTS users (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id       TEXT    NOT NULL UNIQUE,
+  username      TEXT    NOT NULL UNIQUE,
+  password_hash TEXT    NOT NULL,
+  created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- author_id references users.id; NULL for anonymous/seeded posts.
+ALTER TABLE posts ADD COLUMN author_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_author_id
+  ON posts(author_id, created_at DESC, id DESC);
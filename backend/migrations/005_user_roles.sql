@@ -0,0 +1,4 @@
+-- role: "user" or "admin". Admins may edit/delete any post.
+-- There is no API to grant it; promote with:
+--   UPDATE users SET role = 'admin' WHERE username = '...';
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
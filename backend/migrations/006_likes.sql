@@ -0,0 +1,15 @@
+PRAGMA foreign_keys = ON;
+
+-- Likes (one per user per post)
+-- post_db_id references posts.id, user_db_id references users.id (internal primary keys)
+CREATE TABLE IF NOT EXISTS likes (
+  post_db_id INTEGER NOT NULL,
+  user_db_id INTEGER NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (post_db_id, user_db_id),
+  FOREIGN KEY (post_db_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_db_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_likes_user_db_id
+  ON likes(user_db_id, post_db_id);
@@ -0,0 +1,26 @@
+PRAGMA foreign_keys = ON;
+
+-- Comments
+-- id: internal primary key
+-- comment_id: public id
+-- parent_id: comments.id of the comment being replied to; NULL for top-level comments.
+--            Deleting a comment deletes its replies.
+CREATE TABLE IF NOT EXISTS comments (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  comment_id TEXT    NOT NULL UNIQUE,
+  post_db_id INTEGER NOT NULL,
+  parent_id  INTEGER,
+  author_id  INTEGER,
+  body       TEXT    NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (post_db_id) REFERENCES posts(id)    ON DELETE CASCADE,
+  FOREIGN KEY (parent_id)  REFERENCES comments(id) ON DELETE CASCADE,
+  FOREIGN KEY (author_id)  REFERENCES users(id)    ON DELETE SET NULL
+);
+
+-- keyset pagination per post / per thread: (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_comments_post_created_at
+  ON comments(post_db_id, parent_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id
+  ON comments(parent_id);
@@ -0,0 +1,59 @@
+-- requires: fts5
+-- Full-text index over post titles and tags, used by GET /posts?q=...
+-- Skipped at startup when SQLite was built without FTS5; search then falls back to LIKE.
+
+-- rowid = posts.id; tags holds the post's tag names separated by spaces.
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+  title,
+  tags,
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+-- Backfill existing posts
+INSERT INTO posts_fts (rowid, title, tags)
+SELECT
+  p.id,
+  p.title,
+  COALESCE((
+    SELECT GROUP_CONCAT(t.name, ' ')
+    FROM post_tags pt
+    JOIN tags t ON t.id = pt.tag_id
+    WHERE pt.post_db_id = p.id
+  ), '')
+FROM posts p;
+
+-- Keep the index in sync with posts
+CREATE TRIGGER IF NOT EXISTS posts_fts_after_insert AFTER INSERT ON posts BEGIN
+  INSERT INTO posts_fts (rowid, title, tags) VALUES (new.id, new.title, '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_after_update_title AFTER UPDATE OF title ON posts BEGIN
+  UPDATE posts_fts SET title = new.title WHERE rowid = new.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_after_delete AFTER DELETE ON posts BEGIN
+  DELETE FROM posts_fts WHERE rowid = old.id;
+END;
+
+-- ... and with post_tags (tags are attached after the post row is inserted)
+CREATE TRIGGER IF NOT EXISTS posts_fts_after_tag_insert AFTER INSERT ON post_tags BEGIN
+  UPDATE posts_fts
+  SET tags = COALESCE((
+    SELECT GROUP_CONCAT(t.name, ' ')
+    FROM post_tags pt
+    JOIN tags t ON t.id = pt.tag_id
+    WHERE pt.post_db_id = new.post_db_id
+  ), '')
+  WHERE rowid = new.post_db_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_after_tag_delete AFTER DELETE ON post_tags BEGIN
+  UPDATE posts_fts
+  SET tags = COALESCE((
+    SELECT GROUP_CONCAT(t.name, ' ')
+    FROM post_tags pt
+    JOIN tags t ON t.id = pt.tag_id
+    WHERE pt.post_db_id = old.post_db_id
+  ), '')
+  WHERE rowid = old.post_db_id;
+END;
@@ -0,0 +1,15 @@
+PRAGMA foreign_keys = ON;
+
+-- Image renditions of a post (one row per size, see UploadHandler)
+-- Posts whose image_url is not one of our uploads (e.g. seeded images) have none.
+CREATE TABLE IF NOT EXISTS post_images (
+  post_db_id INTEGER NOT NULL,
+  size INTEGER NOT NULL,
+  url TEXT NOT NULL,
+  PRIMARY KEY (post_db_id, size),
+  FOREIGN KEY (post_db_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+-- Reference checks before deleting an object from storage
+CREATE INDEX IF NOT EXISTS idx_post_images_url
+  ON post_images(url);
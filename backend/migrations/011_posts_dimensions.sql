@@ -0,0 +1,4 @@
+-- Pixel size of a post's image_url, so clients can reserve space before the image loads.
+-- NULL for images that were not uploaded through POST /upload (e.g. seeded posts).
+ALTER TABLE posts ADD COLUMN width INTEGER;
+ALTER TABLE posts ADD COLUMN height INTEGER;
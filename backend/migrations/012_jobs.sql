@@ -0,0 +1,23 @@
+-- Durable background job queue (see internal/jobs)
+-- status: pending -> running -> done | failed (pending again between retries)
+-- run_at is unix milliseconds: the earliest time the job may (re)run.
+CREATE TABLE IF NOT EXISTS jobs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  kind TEXT NOT NULL,
+  ref TEXT NOT NULL DEFAULT '',  -- caller's id for lookups, e.g. the upload id
+  payload TEXT NOT NULL,         -- JSON, interpreted by the kind's handler
+  status TEXT NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL,
+  run_at INTEGER NOT NULL,
+  last_error TEXT,
+  result TEXT,                   -- JSON returned by the handler on success
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at
+  ON jobs(status, run_at);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_kind_ref
+  ON jobs(kind, ref);
@@ -0,0 +1,18 @@
+PRAGMA foreign_keys = ON;
+
+-- Every upload, so the ones never used by a post can be garbage collected (see UploadSweeper).
+-- claimed_at is set when CreatePost consumes the upload and stays set if the post is deleted later
+-- (DeletePost removes the objects itself).
+CREATE TABLE IF NOT EXISTS uploads (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  upload_id TEXT NOT NULL UNIQUE,  -- public ULID, also the object key prefix
+  image_url TEXT,                  -- feed-size rendition; NULL until processing finished
+  post_db_id INTEGER,
+  created_at TEXT NOT NULL,
+  claimed_at TEXT,
+  FOREIGN KEY (post_db_id) REFERENCES posts(id) ON DELETE SET NULL
+);
+
+-- Sweeper: unclaimed uploads by age
+CREATE INDEX IF NOT EXISTS idx_uploads_unclaimed
+  ON uploads(created_at) WHERE claimed_at IS NULL;
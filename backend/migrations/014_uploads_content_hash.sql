@@ -0,0 +1,14 @@
+-- Content-hash deduplication of uploads (see processUploadJob)
+-- content_hash: SHA-256 of the processed renditions; NULL until processing finished.
+-- object_id: the upload id whose objects (uploads/<object_id>/...) hold the renditions.
+-- It is the upload's own id unless an identical picture was stored before, then that upload's.
+ALTER TABLE uploads ADD COLUMN content_hash TEXT;
+ALTER TABLE uploads ADD COLUMN object_id TEXT;
+
+UPDATE uploads SET object_id = upload_id WHERE object_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_uploads_content_hash
+  ON uploads(content_hash);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_object_id
+  ON uploads(object_id);
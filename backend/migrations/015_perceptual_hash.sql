@@ -0,0 +1,5 @@
+-- Perceptual hash (imageproc.DHash of the feed-size rendition) for near-duplicate search.
+-- Stored as the signed 64-bit pattern of the uint64. NULL for images not processed by the upload job
+-- (seeded posts, uploads from before this migration).
+ALTER TABLE uploads ADD COLUMN dhash INTEGER;
+ALTER TABLE posts ADD COLUMN dhash INTEGER;
@@ -0,0 +1,5 @@
+-- Pixel size of an upload's image_url (the feed-size rendition), recorded by processUploadJob
+-- so CreatePost doesn't have to fetch and decode the image. NULL until processing finished
+-- and for uploads processed before this migration.
+ALTER TABLE uploads ADD COLUMN width INTEGER;
+ALTER TABLE uploads ADD COLUMN height INTEGER;
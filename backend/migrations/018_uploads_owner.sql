@@ -0,0 +1,6 @@
+-- Who may claim an upload for a post (see resolveUpload).
+-- uploader_id: the signed-in user who uploaded it; NULL for anonymous uploads.
+-- claim_token_hash: SHA-256 (hex) of the upload_token POST /upload returned for an anonymous upload.
+-- Uploads recorded before this migration have neither and can't be claimed; the sweeper removes them.
+ALTER TABLE uploads ADD COLUMN uploader_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE uploads ADD COLUMN claim_token_hash TEXT;
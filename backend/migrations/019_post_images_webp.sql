@@ -0,0 +1,4 @@
+-- WebP encoding of each rendition (stored next to the JPEG, see formatKey), so clients can offer it
+-- with <picture> / srcset: object stores like Spaces serve objects as-is, without Accept negotiation.
+-- NULL for renditions uploaded before WebP encodings were stored.
+ALTER TABLE post_images ADD COLUMN webp_url TEXT;
@@ -1,11 +1,13 @@
 package routes
 
 import (
+	"context"
 	"net/http"
 
 	"instagram-lite-backend/config"
 	"instagram-lite-backend/internal/handlers"
 	"instagram-lite-backend/internal/realtime"
+	"instagram-lite-backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,27 +24,76 @@ func SetupRoutes(router *gin.Engine) {
   // API v1 routes
   v1 := router.Group("/api/v1")
 
-  // Upload route
-  if config.Uploader != nil {
-    uploadHandler := handlers.NewUploadHandler(config.Uploader)
+  // Resolve the bearer token (if any) into the current user for every API route.
+  authHandler := handlers.NewAuthHandler(config.DB, config.Signer)
+  v1.Use(authHandler.Authenticate)
+
+  // Auth routes
+  v1.POST("/auth/register", authHandler.Register)
+  v1.POST("/auth/login", authHandler.Login)
+  v1.GET("/auth/me", handlers.RequireAuth, authHandler.Me)
+
+  // Websocket hub (must be created before the upload and posts handlers)
+  hub := realtime.NewHub(config.Broker)
+
+  // Upload routes
+  if config.Store != nil {
+    uploadHandler := handlers.NewUploadHandler(config.DB, config.Store, config.ImageSizes, config.Jobs, hub)
     v1.POST("/upload", uploadHandler.Upload)
+    v1.GET("/upload/:id", uploadHandler.GetUpload)
+
+    // Garbage collect uploads no post claimed
+    sweeper := handlers.NewUploadSweeper(config.DB, config.Store, handlers.SweeperConfig{
+      TTL:      config.UploadTTL,
+      Interval: config.UploadSweepInterval,
+      DryRun:   config.UploadSweepDryRun,
+    })
+    go sweeper.Run(context.Background())
+
+    // The local store has no public endpoint of its own, so serve its files here.
+    if _, ok := config.Store.(*storage.LocalStore); ok {
+      mediaHandler := handlers.NewMediaHandler(config.Store)
+      router.GET(config.LocalMediaRoute+"/*key", mediaHandler.Serve)
+      router.HEAD(config.LocalMediaRoute+"/*key", mediaHandler.Serve)
+    }
   } else {
     v1.POST("/upload", func(c *gin.Context) {
       c.JSON(http.StatusServiceUnavailable, gin.H{"error": "storage not configured"})
     })
   }
 
-  // Websocket hub (must be created before postsHandler)
-  hub := realtime.NewHub()
-
   // Post routes
-  postsHandler := handlers.NewPostsHandler(config.DB, hub)
+  postsHandler := handlers.NewPostsHandler(config.DB, hub, config.Store, config.ImageSizes)
   v1.POST("/posts", postsHandler.CreatePost)
   v1.GET("/posts", postsHandler.ListPosts)
+  v1.GET("/posts/:id", postsHandler.GetPost)
+  v1.GET("/posts/:id/similar", postsHandler.SimilarPosts)
+  v1.GET("/feed", handlers.RequireAuth, postsHandler.Feed)
+  v1.PATCH("/posts/:id", handlers.RequireAuth, postsHandler.UpdatePost)
+  v1.DELETE("/posts/:id", handlers.RequireAuth, postsHandler.DeletePost)
+  v1.POST("/posts/:id/like", handlers.RequireAuth, postsHandler.LikePost)
+  v1.DELETE("/posts/:id/like", handlers.RequireAuth, postsHandler.UnlikePost)
+
+  // Comment routes
+  commentsHandler := handlers.NewCommentsHandler(config.DB, hub)
+  v1.GET("/posts/:id/comments", commentsHandler.ListComments)
+  v1.POST("/posts/:id/comments", handlers.RequireAuth, commentsHandler.CreateComment)
+  v1.DELETE("/posts/:id/comments/:comment_id", handlers.RequireAuth, commentsHandler.DeleteComment)
+
+  // Follow routes
+  followsHandler := handlers.NewFollowsHandler(config.DB)
+  v1.POST("/users/:id/follow", handlers.RequireAuth, followsHandler.Follow)
+  v1.DELETE("/users/:id/follow", handlers.RequireAuth, followsHandler.Unfollow)
 
   // Websocket route
-  wsHandler := handlers.NewWSHandler(hub)
-  v1.GET("/ws", func(c *gin.Context) {
-    wsHandler.ServeWS(c.Writer, c.Request)
-  })
+  streamCfg := handlers.StreamConfig{
+    AllowedOrigins: config.WSAllowedOrigins,
+    RequireAuth:    config.RealtimeRequireAuth,
+  }
+  wsHandler := handlers.NewWSHandler(hub, authHandler, streamCfg)
+  v1.GET("/ws", wsHandler.ServeWS)
+
+  // Server-Sent Events, for clients that can't use the websocket
+  eventsHandler := handlers.NewEventsHandler(hub, authHandler, streamCfg)
+  v1.GET("/events", eventsHandler.ServeEvents)
 }
\ No newline at end of file
@@ -6,14 +6,79 @@ function App() {
   const [isModalOpen, setIsModalOpen] = useState(false);
   const [successMessage, setSuccessMessage] = useState('');
   const [newPost, setNewPost] = useState(null);
+  const [updatedPost, setUpdatedPost] = useState(null);
+  const [deletedPostId, setDeletedPostId] = useState(null);
   const [searchQuery, setSearchQuery] = useState('');
   const [debouncedSearchQuery, setDebouncedSearchQuery] = useState('');
+  // bumped when the server says we missed too many events; the feed refetches
+  const [resyncCount, setResyncCount] = useState(0);
   const wsRef = useRef(null);
+  // Server-Sent Events stream, used instead of the websocket when upgrades keep failing (e.g. behind a proxy)
+  const eventSourceRef = useRef(null);
+  const connectEventSourceRef = useRef(null);
+  // tag the socket is subscribed to, re-sent when it (re)connects
+  const subscribedTagRef = useRef('');
+  // sequence id of the last event seen, to resume with ?since= after a reconnect
+  const lastSeqRef = useRef(null);
+  // server instance that numbered those events (?node=); resuming on another one means resync_required
+  const lastNodeRef = useRef('');
 
-  // WebSocket connection for real-time updates
+  // Ask the server to only push posts matching the tag search; an empty query unsubscribes (all posts).
+  const sendSubscription = (ws, tag) => {
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify(tag ? { type: 'subscribe', tags: [tag] } : { type: 'unsubscribe' }));
+  };
+
+  // WebSocket connection for real-time updates (Server-Sent Events if the upgrade keeps failing)
   useEffect(() => {
   let isMounted = true;
   let reconnectTimer = null;
+  // websocket attempts in a row that never opened
+  let failedOpens = 0;
+
+  const handleMessage = (event) => {
+    try {
+      const message = JSON.parse(event.data);
+      if (message.seq) {
+        lastSeqRef.current = message.seq;
+      }
+      if (message.type === "connected" && message.data) {
+        lastSeqRef.current = message.data.seq;
+        lastNodeRef.current = message.data.node || '';
+      } else if (message.type === "resync_required" && message.data) {
+        // events were missed while disconnected and can't be replayed
+        lastSeqRef.current = message.data.seq;
+        lastNodeRef.current = message.data.node || '';
+        setResyncCount((n) => n + 1);
+      } else if (message.type === "post_created" && message.data) {
+        setNewPost(message.data);
+      } else if (message.type === "post_updated" && message.data) {
+        setUpdatedPost(message.data);
+      } else if (message.type === "post_deleted" && message.data?.id) {
+        setDeletedPostId(message.data.id);
+      }
+    } catch (err) {
+      console.error("Failed to parse realtime msg:", err);
+    }
+  };
+
+  // SSE can't send subscribe messages: the tag goes in the URL, so a new tag means a new stream.
+  // EventSource reconnects by itself and resumes with Last-Event-ID.
+  const connectEventSource = () => {
+    if (!isMounted) return;
+    if (eventSourceRef.current) eventSourceRef.current.close();
+
+    const params = new URLSearchParams();
+    if (subscribedTagRef.current) params.append('tag', subscribedTagRef.current);
+    if (lastSeqRef.current !== null) {
+      params.append('since', lastSeqRef.current);
+      params.append('node', lastNodeRef.current);
+    }
+    const es = new EventSource(`/api/v1/events?${params.toString()}`);
+    eventSourceRef.current = es;
+    es.onmessage = handleMessage;
+  };
+  connectEventSourceRef.current = connectEventSource;
 
   const connectWebSocket = () => {
     if (!isMounted) return;
@@ -28,33 +93,38 @@ function App() {
       return;
     }
     // TODO. development mode only localhost.
-    const ws = new WebSocket("ws://localhost:8080/api/v1/ws");
+    const since =
+      lastSeqRef.current !== null
+        ? `?${new URLSearchParams({ since: lastSeqRef.current, node: lastNodeRef.current })}`
+        : '';
+    const ws = new WebSocket(`ws://localhost:8080/api/v1/ws${since}`);
     wsRef.current = ws;
+    let opened = false;
 
     ws.onopen = () => {
       console.log("WebSocket connected");
-    };
-
-    ws.onmessage = (event) => {
-      try {
-        const message = JSON.parse(event.data);
-        if (message.type === "post_created" && message.data) {
-          setNewPost(message.data);
-        }
-      } catch (err) {
-        console.error("Failed to parse WebSocket msg:", err);
+      opened = true;
+      failedOpens = 0;
+      if (subscribedTagRef.current) {
+        sendSubscription(ws, subscribedTagRef.current);
       }
     };
 
+    ws.onmessage = handleMessage;
+
     ws.onerror = (err) => {
       console.error("WebSocket error:", err);
     };
 
     ws.onclose = () => {
       wsRef.current = null; 
-      if (isMounted) {
-        reconnectTimer = setTimeout(connectWebSocket, 3000);
+      if (!isMounted) return;
+      if (!opened && ++failedOpens >= 2) {
+        console.log("WebSocket unavailable, falling back to Server-Sent Events");
+        connectEventSource();
+        return;
       }
+      reconnectTimer = setTimeout(connectWebSocket, 3000);
     };
   };
 
@@ -65,6 +135,11 @@ function App() {
 
     if (reconnectTimer) clearTimeout(reconnectTimer);
 
+    if (eventSourceRef.current) {
+      eventSourceRef.current.close();
+      eventSourceRef.current = null;
+    }
+
     const ws = wsRef.current;
     wsRef.current = null;
 
@@ -87,6 +162,25 @@ function App() {
     return () => clearTimeout(timer);
   }, [searchQuery]);
 
+  // Keep the websocket subscription in sync with the tag search
+  useEffect(() => {
+    const tag = debouncedSearchQuery.trim().toLowerCase().replace(/^#+/, '');
+    if (tag === subscribedTagRef.current) return;
+    if (eventSourceRef.current) {
+      subscribedTagRef.current = tag;
+      connectEventSourceRef.current?.();
+      return;
+    }
+    // unsubscribe from the previous tag before subscribing to the new one
+    if (subscribedTagRef.current) {
+      sendSubscription(wsRef.current, '');
+    }
+    subscribedTagRef.current = tag;
+    if (tag) {
+      sendSubscription(wsRef.current, tag);
+    }
+  }, [debouncedSearchQuery]);
+
   const handlePostCreated = (post) => {
     setNewPost(post);
     setSuccessMessage('Your post has been created successfully');
@@ -136,7 +230,7 @@ function App() {
 
       {/* Feed */}
       <main className="max-w-lg mx-auto px-4 py-6 pb-24">
-        <PostFeed newPost={newPost} searchQuery={debouncedSearchQuery} />
+        <PostFeed newPost={newPost} updatedPost={updatedPost} deletedPostId={deletedPostId} searchQuery={debouncedSearchQuery} resyncCount={resyncCount} />
       </main>
 
       {/* Floating Create Button */}
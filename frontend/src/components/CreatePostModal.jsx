@@ -1,8 +1,31 @@
 import { useState } from 'react';
 import ImageUpload from './ImageUpload';
 
+const UPLOAD_POLL_MS = 500;
+const UPLOAD_POLL_TIMEOUT_MS = 60000;
+
+// The upload is processed in the background (POST returns 202 + upload_id); poll until it is ready.
+async function waitForUpload(uploadId) {
+  const deadline = Date.now() + UPLOAD_POLL_TIMEOUT_MS;
+  while (Date.now() < deadline) {
+    const res = await fetch(`/api/v1/upload/${uploadId}`);
+    const data = await res.json();
+    if (!res.ok) {
+      throw new Error(data.error || 'Upload failed');
+    }
+    if (data.status === 'ready') return data;
+    if (data.status === 'failed') {
+      throw new Error(data.error || 'Upload failed');
+    }
+    await new Promise((resolve) => setTimeout(resolve, UPLOAD_POLL_MS));
+  }
+  throw new Error('Upload is taking too long, please try again');
+}
+
 function CreatePostModal({ isOpen, onClose, onPostCreated }) {
   const [imageUrl, setImageUrl] = useState('');
+  // Secret of the anonymous upload; creating the post needs it
+  const [uploadToken, setUploadToken] = useState('');
   const [uploading, setUploading] = useState(false);
   const [posting, setPosting] = useState(false);
   const [error, setError] = useState('');
@@ -13,6 +36,7 @@ function CreatePostModal({ isOpen, onClose, onPostCreated }) {
   // Reset State
   const resetState = () => {
     setImageUrl('');
+    setUploadToken('');
     setUploading(false);
     setPosting(false);
     setError('');
@@ -46,8 +70,10 @@ function CreatePostModal({ isOpen, onClose, onPostCreated }) {
       if (!res.ok) {
         throw new Error(data.error || 'Upload failed');
       }
-      // Use the response.data.image_url as the image preview src
-      setImageUrl(data.image_url);
+      const upload = await waitForUpload(data.upload_id);
+      // Use the processed image_url as the image preview src
+      setImageUrl(upload.image_url);
+      setUploadToken(data.upload_token || '');
     } catch (err) {
       setError(err.message);
     } finally {
@@ -58,6 +84,7 @@ function CreatePostModal({ isOpen, onClose, onPostCreated }) {
   // Remove image handler
   const handleRemove = () => {
     setImageUrl('');
+    setUploadToken('');
     setError('');
     setTitle('');
     setTagInput('');
@@ -119,7 +146,12 @@ function CreatePostModal({ isOpen, onClose, onPostCreated }) {
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify({ image_url: imageUrl, title: title.trim(), tags: finalTags }),
+        body: JSON.stringify({
+          image_url: imageUrl,
+          upload_token: uploadToken,
+          title: title.trim(),
+          tags: finalTags,
+        }),
       });
 
       const data = await res.json();
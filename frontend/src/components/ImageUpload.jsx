@@ -64,7 +64,7 @@ function ImageUpload({ imageUrl, uploading, onFileSelect, onRemove }) {
           <img
             src={imageUrl}
             alt="Preview"
-            className="w-full aspect-square object-cover"
+            className="w-full h-auto object-cover"
           />
           <button
             onClick={onRemove}
@@ -8,7 +8,16 @@ const ensureUniqueId = (post) => {
   return post;
 };
 
-function PostFeed({ newPost, searchQuery }) {
+// Mock ids are made unique on the client, so match on the original id prefix too.
+const isSamePost = (post, id) => post.id === id || post.id?.startsWith(`${id}-`);
+
+// Let the browser pick a rendition ("150" -> "url 150w"); undefined for posts without renditions.
+const srcSetOf = (images) => {
+  const entries = Object.entries(images || {});
+  return entries.length ? entries.map(([size, url]) => `${url} ${size}w`).join(', ') : undefined;
+};
+
+function PostFeed({ newPost, updatedPost, deletedPostId, searchQuery, resyncCount }) {
   const [posts, setPosts] = useState([]);
   const [cursor, setCursor] = useState(null);
   const [loading, setLoading] = useState(false);
@@ -90,8 +99,9 @@ function PostFeed({ newPost, searchQuery }) {
         if (!newPost.id?.startsWith('mock-') && prev.some((p) => p.id === newPost.id)) {
           return prev;
         }
-        // Apply fuzzy filter in frontend if search query is active(filter items pushed by websocket)
-        const query = searchQuery?.trim().toLowerCase();
+        // Apply fuzzy filter in frontend if search query is active. The server already filters
+        // websocket pushes by our subscription, but our own new post arrives here unfiltered.
+        const query = searchQuery?.trim().toLowerCase().replace(/^#+/, '');
         if (query) {
           const matchesTag = newPost.tags?.some((tag) =>
             tag.toLowerCase().includes(query)
@@ -105,13 +115,29 @@ function PostFeed({ newPost, searchQuery }) {
     }
   }, [newPost, searchQuery]);
 
-  // Fetch posts on mount and when search query changes
+  // Refresh the card in place when a post_updated event arrives
+  useEffect(() => {
+    if (updatedPost) {
+      setPosts((prev) =>
+        prev.map((p) => (isSamePost(p, updatedPost.id) ? { ...updatedPost, id: p.id } : p))
+      );
+    }
+  }, [updatedPost]);
+
+  // Drop the card when a post_deleted event arrives
+  useEffect(() => {
+    if (deletedPostId) {
+      setPosts((prev) => prev.filter((p) => !isSamePost(p, deletedPostId)));
+    }
+  }, [deletedPostId]);
+
+  // Fetch posts on mount, when search query changes and when realtime events were missed
   useEffect(() => {
     // Reset and fetch with new search
     setCursor(null);
     setHasMore(true);
     fetchPosts(true);
-  }, [searchQuery]);
+  }, [searchQuery, resyncCount]);
 
   // Empty state: no posts yet, or no matches for the current tag search.
   if (posts.length === 0 && !loading) {
@@ -153,11 +179,26 @@ function PostFeed({ newPost, searchQuery }) {
               </div>
               <span className="ml-3 font-semibold text-sm">user</span>
             </div>
-            <img
-              src={post.image_url}
-              alt=""
-              className="w-full aspect-square object-cover"
-            />
+            <picture>
+              {/* Browsers that decode WebP take the smaller encoding, the others fall back to the JPEGs */}
+              {srcSetOf(post.images_webp) && (
+                <source
+                  type="image/webp"
+                  srcSet={srcSetOf(post.images_webp)}
+                  sizes="(max-width: 640px) 100vw, 640px"
+                />
+              )}
+              <img
+                src={post.image_url}
+                srcSet={srcSetOf(post.images)}
+                sizes="(max-width: 640px) 100vw, 640px"
+                alt=""
+                // Known dimensions reserve the right height before the image loads (no layout shift)
+                width={post.width ?? undefined}
+                height={post.height ?? undefined}
+                className={`w-full object-cover ${post.width && post.height ? 'h-auto' : 'aspect-square'}`}
+              />
+            </picture>
             <div className="p-4">
               <div className="flex items-center gap-4 mb-2">
                 <button className="hover:text-red-500 transition-colors">